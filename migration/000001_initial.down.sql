@@ -1,7 +1,9 @@
 
 BEGIN;
 
-DROP CREATE task;
+DROP FUNCTION ReleaseLock(VARCHAR(100), TIMESTAMP);
+DROP FUNCTION AcquireLock(VARCHAR(100), INT);
+DROP TABLE task;
 DROP TABLE Lock ;
 
 END;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE users;
+
+END;
@@ -0,0 +1,16 @@
+
+BEGIN;
+
+CREATE TABLE users (
+     id VARCHAR(50) NOT NULL PRIMARY KEY,
+     name VARCHAR(200) NOT NULL,
+     age INT NOT NULL,
+     version BIGINT NOT NULL,
+     created_at TIMESTAMPTZ NOT NULL,
+     updated_at TIMESTAMPTZ NOT NULL
+ );
+
+CREATE INDEX users_lower_name_idx ON users (lower(name));
+CREATE INDEX users_age_idx ON users (age);
+
+END;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE idempotency_key;
+
+END;
@@ -0,0 +1,18 @@
+
+BEGIN;
+
+CREATE TABLE idempotency_key (
+     client VARCHAR(200) NOT NULL,
+     key VARCHAR(255) NOT NULL,
+     fingerprint CHAR(64) NOT NULL,
+     status_code INT NOT NULL,
+     header JSONB NOT NULL,
+     body BYTEA NOT NULL,
+     created_at TIMESTAMPTZ NOT NULL,
+     expires_at TIMESTAMPTZ NOT NULL,
+     PRIMARY KEY (client, key)
+ );
+
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
+
+END;
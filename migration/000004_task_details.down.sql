@@ -0,0 +1,15 @@
+
+BEGIN;
+
+DROP INDEX task_status_idx;
+
+ALTER TABLE task
+     DROP COLUMN type,
+     DROP COLUMN payload,
+     DROP COLUMN result,
+     DROP COLUMN error,
+     DROP COLUMN started_at,
+     DROP COLUMN finished_at,
+     DROP COLUMN updated_at;
+
+END;
@@ -0,0 +1,15 @@
+
+BEGIN;
+
+ALTER TABLE task
+     ADD COLUMN type VARCHAR(100) NOT NULL DEFAULT '',
+     ADD COLUMN payload JSONB,
+     ADD COLUMN result JSONB,
+     ADD COLUMN error TEXT NOT NULL DEFAULT '',
+     ADD COLUMN started_at TIMESTAMPTZ,
+     ADD COLUMN finished_at TIMESTAMPTZ,
+     ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX task_status_idx ON task (status, submitted_at);
+
+END;
@@ -0,0 +1,13 @@
+
+BEGIN;
+
+DROP INDEX task_running_idx;
+DROP INDEX task_queued_idx;
+
+ALTER TABLE task
+     DROP COLUMN attempts,
+     DROP COLUMN run_after,
+     DROP COLUMN worker,
+     DROP COLUMN heartbeat_at;
+
+END;
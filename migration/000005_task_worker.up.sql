@@ -0,0 +1,13 @@
+
+BEGIN;
+
+ALTER TABLE task
+     ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+     ADD COLUMN run_after TIMESTAMPTZ NOT NULL DEFAULT now(),
+     ADD COLUMN worker VARCHAR(255) NOT NULL DEFAULT '',
+     ADD COLUMN heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX task_queued_idx ON task (run_after, submitted_at) WHERE status = 'queued';
+CREATE INDEX task_running_idx ON task (heartbeat_at) WHERE status = 'running';
+
+END;
@@ -0,0 +1,12 @@
+
+BEGIN;
+
+DROP FUNCTION ReleaseLockToken(VARCHAR(100), BIGINT);
+DROP FUNCTION RenewLock(VARCHAR(100), BIGINT, INT);
+DROP FUNCTION AcquireLockToken(VARCHAR(100), INT);
+
+ALTER TABLE Lock DROP COLUMN token;
+
+DROP SEQUENCE lock_token_seq;
+
+END;
@@ -0,0 +1,40 @@
+
+BEGIN;
+
+-- Fencing tokens: every acquisition of a lock gets a token greater than all
+-- tokens handed out before, so writes guarded by the lock can reject stale holders.
+CREATE SEQUENCE lock_token_seq;
+
+ALTER TABLE Lock ADD COLUMN token BIGINT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION AcquireLockToken(VARCHAR(100), INT) RETURNS BIGINT AS $$
+	DECLARE
+		tokenT BIGINT;
+	BEGIN
+		INSERT INTO Lock AS l (lock_id, expires, token)
+			VALUES ($1, CURRENT_TIMESTAMP + '1 SECOND'::interval * $2, nextval('lock_token_seq'))
+		ON CONFLICT (lock_id) DO UPDATE
+			SET expires = EXCLUDED.expires, token = EXCLUDED.token
+			WHERE l.expires <= CURRENT_TIMESTAMP
+		RETURNING l.token INTO tokenT;
+
+		RETURN COALESCE(tokenT, 0); -- Special value indicating no lock acquired.
+	END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION RenewLock(VARCHAR(100), BIGINT, INT) RETURNS BOOLEAN AS $$
+	BEGIN
+		UPDATE Lock SET expires = CURRENT_TIMESTAMP + '1 SECOND'::interval * $3
+		WHERE lock_id = $1 AND token = $2;
+		RETURN FOUND; -- FALSE if another process acquired the lock after it expired
+	END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION ReleaseLockToken(VARCHAR(100), BIGINT) RETURNS BOOLEAN AS $$
+	BEGIN
+		DELETE FROM Lock WHERE lock_id = $1 AND token = $2;
+		RETURN FOUND; -- FALSE if another process acquired the lock after it expired
+	END
+$$ LANGUAGE plpgsql;
+
+END;
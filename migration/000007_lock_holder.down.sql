@@ -0,0 +1,6 @@
+
+BEGIN;
+
+ALTER TABLE Lock DROP COLUMN holder;
+
+END;
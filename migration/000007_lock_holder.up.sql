@@ -0,0 +1,7 @@
+
+BEGIN;
+
+-- holder names the process holding a lock, e.g. the current leader of an election.
+ALTER TABLE Lock ADD COLUMN holder VARCHAR(255) NOT NULL DEFAULT '';
+
+END;
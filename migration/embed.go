@@ -0,0 +1,10 @@
+// Package migration embeds the database schema migrations, so the binary can
+// apply them without the SQL files on disk.
+package migration
+
+import "embed"
+
+// FS holds the migration files, named <version>_<title>.<up|down>.sql.
+//
+//go:embed *.sql
+var FS embed.FS
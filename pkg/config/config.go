@@ -0,0 +1,260 @@
+// Package config loads configuration from a file, the environment and command
+// line flags into structs with go-envconfig "env" tags.
+//
+// Every setting is named by its environment variable, e.g. DB_NAME. A flag
+// wins over the environment, which wins over the file, which wins over the
+// default of the tag.
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sethvargo/go-envconfig"
+	"github.com/spf13/viper"
+)
+
+// Sources of settings, as returned by Loader.Source.
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+// Loader looks up settings in flags, the environment then a file. It is an
+// envconfig.Lookuper.
+type Loader struct {
+	path     string
+	settings []string
+
+	flags map[string]string
+	env   envconfig.Lookuper
+	file  map[string]string
+}
+
+var _ envconfig.Lookuper = (*Loader)(nil)
+
+// NewLoader returns a Loader of the settings in flags, given as KEY=VALUE, in
+// env, then in file. file may be empty; its format, YAML, JSON or TOML, is
+// told by its extension. Its keys are the names of the settings, e.g.
+//
+//	DB_NAME: app
+//
+// or their parts, nested:
+//
+//	db:
+//	  name: app
+func NewLoader(file string, flags []string, env envconfig.Lookuper) (*Loader, error) {
+	l := &Loader{path: file, settings: flags, flags: make(map[string]string), env: env, file: make(map[string]string)}
+	for _, f := range flags {
+		i := strings.Index(f, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid setting %q, expected KEY=VALUE", f)
+		}
+		l.flags[strings.ToUpper(f[:i])] = f[i+1:]
+	}
+
+	if file == "" {
+		return l, nil
+	}
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType(strings.TrimPrefix(filepath.Ext(file), "."))
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	flatten("", v.AllSettings(), l.file)
+	return l, nil
+}
+
+// File returns the path of the config file, empty if there is none.
+func (l *Loader) File() string {
+	return l.path
+}
+
+// Reload returns a Loader of the same flags and environment, and of the
+// current content of the file.
+func (l *Loader) Reload() (*Loader, error) {
+	return NewLoader(l.path, l.settings, l.env)
+}
+
+// flatten sets the values of settings in out, their keys joined by "_" to
+// prefix and upper-cased.
+func flatten(prefix string, settings map[string]interface{}, out map[string]string) {
+	for k, v := range settings {
+		key := strings.ToUpper(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case []interface{}:
+			s := make([]string, len(v))
+			for i := range v {
+				s[i] = fmt.Sprint(v[i])
+			}
+			out[key] = strings.Join(s, ",")
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// Lookup implements envconfig.Lookuper.
+func (l *Loader) Lookup(key string) (string, bool) {
+	v, _, ok := l.lookup(key)
+	return v, ok
+}
+
+// Source returns where the setting key comes from, SourceDefault if it is
+// not set.
+func (l *Loader) Source(key string) string {
+	_, source, _ := l.lookup(key)
+	return source
+}
+
+func (l *Loader) lookup(key string) (string, string, bool) {
+	if v, ok := l.flags[key]; ok {
+		return v, SourceFlag, true
+	}
+	if l.env != nil {
+		if v, ok := l.env.Lookup(key); ok {
+			return v, SourceEnv, true
+		}
+	}
+	if v, ok := l.file[key]; ok {
+		return v, SourceFile, true
+	}
+	return "", SourceDefault, false
+}
+
+// Validator is implemented by configurations checking their settings.
+type Validator interface {
+	Validate() error
+}
+
+// Load sets the fields of v, a pointer to a struct, from the settings of l and
+// validates it if it is a Validator.
+func Load(ctx context.Context, l envconfig.Lookuper, v interface{}) error {
+	if err := envconfig.ProcessWith(ctx, v, l); err != nil {
+		return err
+	}
+	if val, ok := v.(Validator); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+// Errors aggregates the problems found validating a configuration.
+type Errors []error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(s, "; ")
+}
+
+// Add appends err, unless nil, flattening Errors.
+func (e *Errors) Add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case Errors:
+		*e = append(*e, err...)
+	default:
+		*e = append(*e, err)
+	}
+}
+
+// Err returns e, or nil if it is empty.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Setting is a field of a configuration.
+type Setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Secret settings, tagged `secret:"true"`, have their value masked.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// mask replaces the value of secret settings.
+const mask = "********"
+
+// settingKey returns the name of the setting of field f.
+func settingKey(f reflect.StructField) string {
+	return strings.TrimSpace(strings.Split(f.Tag.Get("env"), ",")[0])
+}
+
+// settingValue formats the value v of field f, masked if f is secret.
+func settingValue(f reflect.StructField, v reflect.Value) string {
+	switch {
+	case f.Tag.Get("secret") == "true" && !v.IsZero():
+		return mask
+	case v.Kind() == reflect.Slice:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// Settings lists the settings of v, a struct or a pointer to one, sorted by
+// key.
+func Settings(v interface{}) []Setting {
+	return settingsOf(v, false)
+}
+
+// InfoSettings lists the settings of v which opted in to be shown at runtime,
+// tagged `info:"true"`, sorted by key. A setting added later stays hidden
+// until it is tagged.
+func InfoSettings(v interface{}) []Setting {
+	return settingsOf(v, true)
+}
+
+func settingsOf(v interface{}, info bool) []Setting {
+	var settings []Setting
+	collect(reflect.Indirect(reflect.ValueOf(v)), info, &settings)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+func collect(v reflect.Value, info bool, settings *[]Setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		tag := f.Tag.Get("env")
+		if tag == "" {
+			if fv.Kind() == reflect.Struct {
+				collect(fv, info, settings)
+			}
+			continue
+		}
+		if info && f.Tag.Get("info") != "true" {
+			continue
+		}
+
+		*settings = append(*settings, Setting{
+			Key:    settingKey(f),
+			Value:  settingValue(f, fv),
+			Secret: f.Tag.Get("secret") == "true",
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+type dbConfig struct {
+	Name     string   `env:"DB_NAME" info:"true"`
+	Port     int      `env:"DB_PORT, default=5432" info:"true"`
+	Password string   `env:"DB_PASSWORD" secret:"true" info:"true"`
+	Replicas []string `env:"DB_REPLICA_HOSTS"`
+}
+
+type testConfig struct {
+	DB      dbConfig
+	Timeout time.Duration `env:"TIMEOUT, default=30s" info:"true"`
+	Level   string        `env:"LOG_LEVEL, default=info"`
+	Token   string        `env:"TOKEN" secret:"true"`
+	ignored string
+}
+
+func (c *testConfig) Validate() error {
+	var errs Errors
+	if c.DB.Port <= 0 {
+		errs.Add(errors.New("DB_PORT must be positive"))
+	}
+	if c.Timeout <= 0 {
+		errs.Add(errors.New("TIMEOUT must be positive"))
+	}
+	return errs.Err()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoader(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "db:\n  name: from-file\n  port: 6000\n  replica_hosts: [r1, r2]\nlog_level: debug\nTIMEOUT: 10s\n",
+		"config.json": `{"db": {"name": "from-file", "port": 6000, "replica_hosts": ["r1", "r2"]}, "log_level": "debug", "TIMEOUT": "10s"}`,
+		"config.toml": "log_level = \"debug\"\nTIMEOUT = \"10s\"\n[db]\nname = \"from-file\"\nport = 6000\nreplica_hosts = [\"r1\", \"r2\"]\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			env := envconfig.MapLookuper(map[string]string{"DB_NAME": "from-env", "LOG_LEVEL": "warn"})
+			l, err := NewLoader(writeFile(t, name, content), []string{"log_level=error"}, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var c testConfig
+			if err := Load(context.Background(), l, &c); err != nil {
+				t.Fatal(err)
+			}
+			want := testConfig{
+				DB:      dbConfig{Name: "from-env", Port: 6000, Replicas: []string{"r1", "r2"}},
+				Timeout: 10 * time.Second,
+				Level:   "error",
+			}
+			if c.DB.Name != want.DB.Name || c.DB.Port != want.DB.Port || strings.Join(c.DB.Replicas, ",") != "r1,r2" || c.Timeout != want.Timeout || c.Level != want.Level {
+				t.Fatalf("got %+v, wanted %+v", c, want)
+			}
+
+			for key, source := range map[string]string{
+				"LOG_LEVEL":   SourceFlag,
+				"DB_NAME":     SourceEnv,
+				"DB_PORT":     SourceFile,
+				"DB_PASSWORD": SourceDefault,
+			} {
+				if got := l.Source(key); got != source {
+					t.Errorf("got source %q for %s, wanted %q", got, key, source)
+				}
+			}
+		})
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	if _, err := NewLoader("", []string{"NOVALUE"}, nil); err == nil {
+		t.Error("accepted a flag without value")
+	}
+	if _, err := NewLoader(filepath.Join(t.TempDir(), "missing.yaml"), nil, nil); err == nil {
+		t.Error("accepted a missing file")
+	}
+	if _, err := NewLoader(writeFile(t, "bad.yaml", "db: [unclosed"), nil, nil); err == nil {
+		t.Error("accepted an invalid file")
+	}
+
+	// Validation reports every problem at once.
+	l, err := NewLoader("", []string{"DB_PORT=-1", "TIMEOUT=-1s"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c testConfig
+	err = Load(context.Background(), l, &c)
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("got %v, wanted the 2 invalid settings", err)
+	}
+	if !strings.Contains(err.Error(), "DB_PORT") || !strings.Contains(err.Error(), "TIMEOUT") {
+		t.Fatalf("got %q, wanted both settings named", err)
+	}
+}
+
+func TestErrorsAdd(t *testing.T) {
+	var errs Errors
+	errs.Add(nil)
+	if errs.Err() != nil {
+		t.Fatal("got an error without problems")
+	}
+	errs.Add(errors.New("a"))
+	errs.Add(Errors{errors.New("b"), errors.New("c")})
+	if len(errs) != 3 || errs.Error() != "invalid configuration: a; b; c" {
+		t.Fatalf("got %q, wanted 3 flattened errors", errs)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	c := testConfig{
+		DB:      dbConfig{Name: "app", Port: 5432, Password: "hunter2", Replicas: []string{"r1", "r2"}},
+		Timeout: time.Second,
+		ignored: "x",
+	}
+	var lines []string
+	for _, s := range Settings(&c) {
+		lines = append(lines, s.Key+"="+s.Value)
+	}
+	want := []string{
+		"DB_NAME=app",
+		"DB_PASSWORD=" + mask,
+		"DB_PORT=5432",
+		"DB_REPLICA_HOSTS=r1,r2",
+		"LOG_LEVEL=",
+		"TIMEOUT=1s",
+		"TOKEN=",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwanted\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInfoSettings(t *testing.T) {
+	c := testConfig{
+		DB:      dbConfig{Name: "app", Port: 5432, Password: "hunter2", Replicas: []string{"r1", "r2"}},
+		Timeout: time.Second,
+		Token:   "s3cret",
+	}
+	var lines []string
+	for _, s := range InfoSettings(&c) {
+		lines = append(lines, s.Key+"="+s.Value)
+	}
+	want := []string{
+		"DB_NAME=app",
+		"DB_PASSWORD=" + mask,
+		"DB_PORT=5432",
+		"TIMEOUT=1s",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwanted\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
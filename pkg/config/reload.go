@@ -0,0 +1,104 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Change is a setting which differs between two configurations.
+type Change struct {
+	Key string `json:"key"`
+	// Old and New are masked for secret settings.
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Reloadable settings, tagged `reload:"true"`, can change while the
+	// application runs.
+	Reloadable bool `json:"reloadable"`
+}
+
+// Diff lists the settings which differ between old and new, structs of the
+// same type or pointers to them.
+func Diff(old, new interface{}) []Change {
+	var changes []Change
+	diff(reflect.Indirect(reflect.ValueOf(old)), reflect.Indirect(reflect.ValueOf(new)), &changes)
+	return changes
+}
+
+func diff(old, new reflect.Value, changes *[]Change) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		o, n := old.Field(i), new.Field(i)
+		if f.Tag.Get("env") == "" {
+			if o.Kind() == reflect.Struct {
+				diff(o, n, changes)
+			}
+			continue
+		}
+		if reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+		c := Change{Key: settingKey(f), Reloadable: f.Tag.Get("reload") == "true"}
+		c.Old, c.New = settingValue(f, o), settingValue(f, n)
+		if c.Old == c.New && f.Tag.Get("secret") == "true" {
+			c.New = mask + " (changed)"
+		}
+		*changes = append(*changes, c)
+	}
+}
+
+// CopyReloadable copies the reloadable settings of src to dst, a pointer to a
+// struct of the type of src.
+func CopyReloadable(dst, src interface{}) {
+	copyReloadable(reflect.ValueOf(dst).Elem(), reflect.Indirect(reflect.ValueOf(src)))
+}
+
+func copyReloadable(dst, src reflect.Value) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		switch {
+		case f.Tag.Get("reload") == "true":
+			dst.Field(i).Set(src.Field(i))
+		case f.Tag.Get("env") == "" && f.Type.Kind() == reflect.Struct:
+			copyReloadable(dst.Field(i), src.Field(i))
+		}
+	}
+}
+
+// Watch calls onChange whenever the modification time or the size of the
+// file at path changes, checking every interval until ctx is done.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	mtime, size := stat()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m, s := stat()
+		if m.Equal(mtime) && s == size {
+			continue
+		}
+		mtime, size = m, s
+		onChange()
+	}
+}
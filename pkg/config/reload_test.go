@@ -0,0 +1,87 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+type reloadConfig struct {
+	DB    dbConfig
+	Level string   `env:"LOG_LEVEL" reload:"true"`
+	Flags []string `env:"FLAGS" reload:"true"`
+	Port  int      `env:"PORT"`
+}
+
+func TestDiff(t *testing.T) {
+	old := reloadConfig{DB: dbConfig{Name: "app", Password: "a"}, Level: "info", Port: 80}
+	new := reloadConfig{DB: dbConfig{Name: "app", Password: "b"}, Level: "debug", Flags: []string{"x", "y"}, Port: 8080}
+
+	got := Diff(&old, new)
+	want := []Change{
+		{Key: "DB_PASSWORD", Old: mask, New: mask + " (changed)"},
+		{Key: "LOG_LEVEL", Old: "info", New: "debug", Reloadable: true},
+		{Key: "FLAGS", Old: "", New: "x,y", Reloadable: true},
+		{Key: "PORT", Old: "80", New: "8080"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, wanted %+v", got, want)
+	}
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Fatalf("got %+v, wanted no change", changes)
+	}
+}
+
+func TestCopyReloadable(t *testing.T) {
+	dst := reloadConfig{Level: "info", Port: 80}
+	CopyReloadable(&dst, reloadConfig{DB: dbConfig{Name: "app"}, Level: "debug", Flags: []string{"x"}, Port: 8080})
+
+	want := reloadConfig{Level: "debug", Flags: []string{"x"}, Port: 80}
+	if !reflect.DeepEqual(dst, want) {
+		t.Fatalf("got %+v, wanted %+v", dst, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := writeFile(t, "config.yaml", "port: 80\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go Watch(ctx, path, 10*time.Millisecond, func() { changed <- struct{}{} })
+
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("port: 8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change of the file not detected")
+	}
+}
+
+func TestLoaderReload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "log_level: info\nport: 80\n")
+	l, err := NewLoader(path, []string{"PORT=90"}, envconfig.MapLookuper(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("log_level: debug\nport: 8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err = l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := l.Lookup("LOG_LEVEL"); v != "debug" {
+		t.Errorf("LOG_LEVEL = %q, wanted the new value of the file", v)
+	}
+	if v, _ := l.Lookup("PORT"); v != "90" {
+		t.Errorf("PORT = %q, wanted the flag to still win", v)
+	}
+}
@@ -0,0 +1,53 @@
+package exampleapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/task"
+)
+
+// awrReportTask is the task type generating an Oracle AWR report.
+const awrReportTask = "awr_report"
+
+// awrRequest is the payload of an awr_report task.
+type awrRequest struct {
+	DB        string `json:"db"`
+	BeginSnap int64  `json:"begin_snap"`
+	EndSnap   int64  `json:"end_snap"`
+}
+
+// awrReport is the result of an awr_report task.
+type awrReport struct {
+	awrRequest
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+func (r awrRequest) validate() error {
+	if r.DB == "" {
+		return errors.New("db is required")
+	}
+	if r.BeginSnap <= 0 || r.EndSnap <= r.BeginSnap {
+		return fmt.Errorf("invalid snapshot range [%d, %d]", r.BeginSnap, r.EndSnap)
+	}
+	return nil
+}
+
+// runAWRReport handles awr_report tasks. A malformed payload fails the task
+// at once since retrying it cannot help.
+func runAWRReport(ctx context.Context, t *task.Task) (json.RawMessage, error) {
+	var req awrRequest
+	if err := json.Unmarshal(t.Payload, &req); err != nil {
+		return nil, task.Permanent(fmt.Errorf("decoding payload: %w", err))
+	}
+	if err := req.validate(); err != nil {
+		return nil, task.Permanent(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(awrReport{awrRequest: req, GeneratedAt: time.Now().UTC()})
+}
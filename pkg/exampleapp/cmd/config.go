@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/jusongchen/REST-app/pkg/exampleapp"
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "config inspects the configuration",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "print the effective configuration with secrets masked",
+	Long: `show prints every setting as KEY=value followed by where it comes from:
+flag, env, file or default. It fails if the configuration is invalid.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		l, err := newLoader()
+		if err != nil {
+			return err
+		}
+		return exampleapp.PrintConfig(context.Background(), l, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/jusongchen/REST-app/migration"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+var dbSourceDir string
+
+// dbCmd represents the db command
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "db inspects the database",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+	},
+}
+
+var dbVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "compare the database schema to the one the migrations produce",
+	Long: `verify applies the migrations to a scratch database, up then down then up
+again, and compares the result to the database configured by the DB_*
+environment variables. It reports hotfixes applied by hand, migrations not
+applied, and down migrations which do not revert their up migration.
+
+The database user needs the CREATEDB privilege.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := loadDBConfig()
+		if err != nil {
+			return err
+		}
+
+		var src fs.FS = migration.FS
+		if dbSourceDir != "" {
+			src = os.DirFS(dbSourceDir)
+		}
+
+		report, err := postgres.VerifySchema(cmd.Context(), conf, src)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, d := range report.Drift {
+			fmt.Fprintf(out, "drift: %s\n", d)
+		}
+		for _, d := range report.Irreversible {
+			fmt.Fprintf(out, "irreversible: %s\n", d)
+		}
+		if !report.OK() {
+			return fmt.Errorf("schema verification failed: %d drifts, %d irreversible changes", len(report.Drift), len(report.Irreversible))
+		}
+		fmt.Fprintln(out, "schema matches the migrations")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbVerifyCmd)
+
+	dbVerifyCmd.Flags().StringVar(&dbSourceDir, "source-dir", "", "read migrations from this directory instead of the embedded ones")
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/jusongchen/REST-app/migration"
+	"github.com/jusongchen/REST-app/pkg/config"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateDryRun    bool
+	migrateSourceDir string
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "migrate applies database schema migrations",
+	Long: `migrate applies the database schema migrations embedded in demoapp
+to the database configured by the DB_* environment variables.`,
+	// Arguments are valid once a subcommand runs: do not print usage on
+	// errors, and leave printing them to Execute.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "apply all pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd, func(m *postgres.Migrator) error {
+			if migrateDryRun {
+				return printPlan(cmd, m.PlanUp)
+			}
+			return m.Up()
+		})
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down N",
+	Short: "revert the last N migrations",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of migrations %q", args[0])
+		}
+		return withMigrator(cmd, func(m *postgres.Migrator) error {
+			if migrateDryRun {
+				return printPlan(cmd, func() ([]postgres.Step, error) { return m.PlanDown(n) })
+			}
+			return m.Down(n)
+		})
+	},
+}
+
+var migrateGotoCmd = &cobra.Command{
+	Use:   "goto V",
+	Short: "migrate up or down to version V",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return withMigrator(cmd, func(m *postgres.Migrator) error {
+			if migrateDryRun {
+				return printPlan(cmd, func() ([]postgres.Step, error) { return m.PlanGoto(uint(v)) })
+			}
+			return m.Goto(uint(v))
+		})
+	},
+}
+
+var migrateVersionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "print the schema version of the database",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(cmd, func(m *postgres.Migrator) error {
+			v, dirty, err := m.Version()
+			if err != nil {
+				return err
+			}
+			if dirty {
+				fmt.Fprintf(cmd.OutOrStdout(), "%d (dirty)\n", v)
+				return nil
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), v)
+			return nil
+		})
+	},
+}
+
+var migrateForceCmd = &cobra.Command{
+	Use:   "force V",
+	Short: "set the schema version to V without running migrations, clearing the dirty flag",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < -1 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return withMigrator(cmd, func(m *postgres.Migrator) error {
+			return m.Force(v)
+		})
+	},
+}
+
+// withMigrator runs f with a Migrator for the configured database.
+func withMigrator(cmd *cobra.Command, f func(m *postgres.Migrator) error) error {
+	conf, err := loadDBConfig()
+	if err != nil {
+		return err
+	}
+
+	var src fs.FS = migration.FS
+	if migrateSourceDir != "" {
+		src = os.DirFS(migrateSourceDir)
+	}
+
+	connURL, err := conf.ConnectionURL(cmd.Context())
+	if err != nil {
+		return err
+	}
+	m, err := postgres.NewMigrator(connURL, src)
+	if err != nil {
+		return err
+	}
+	if err := f(m); err != nil {
+		m.Close()
+		return err
+	}
+	return m.Close()
+}
+
+// loadDBConfig loads and validates the database settings.
+func loadDBConfig() (*postgres.Config, error) {
+	l, err := newLoader()
+	if err != nil {
+		return nil, err
+	}
+	var conf postgres.Config
+	if err := config.Load(context.Background(), l, &conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// printPlan prints the migrations plan would run.
+func printPlan(cmd *cobra.Command, plan func() ([]postgres.Step, error)) error {
+	steps, err := plan()
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "no change")
+	}
+	for _, s := range steps {
+		fmt.Fprintln(cmd.OutOrStdout(), s)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateGotoCmd, migrateVersionCmd, migrateForceCmd)
+
+	migrateCmd.PersistentFlags().StringVar(&migrateSourceDir, "source-dir", "", "read migrations from this directory instead of the embedded ones")
+	for _, c := range []*cobra.Command{migrateUpCmd, migrateDownCmd, migrateGotoCmd} {
+		c.Flags().BoolVar(&migrateDryRun, "dry-run", false, "list the migrations to run without running them")
+	}
+}
@@ -5,19 +5,24 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jusongchen/REST-app/pkg/config"
+	"github.com/sethvargo/go-envconfig"
 	"github.com/spf13/cobra"
-
-	homedir "github.com/mitchellh/go-homedir"
-	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile  string
+	settings []string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "demoapp",
 	Short: "demoapp is a DB stats service providing Oracle AWR report generation",
-	Long:  `demoapp is a DB stats service providing Oracle AWR report generation`,
+	Long: `demoapp is a DB stats service providing Oracle AWR report generation
+
+Settings are named by their environment variable, e.g. DB_NAME. They are
+read from --set flags first, then the environment, then the --config file.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
@@ -33,41 +38,12 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
-
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.demoapp.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", os.Getenv("DEMOAPP_CONFIG"), "YAML, JSON or TOML config file (default is $DEMOAPP_CONFIG)")
+	rootCmd.PersistentFlags().StringArrayVar(&settings, "set", nil, "set a setting, as KEY=VALUE, overriding the environment and the config file")
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		// Search config in home directory with name ".demoapp" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".demoapp")
-	}
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
-	}
+// newLoader returns the loader of the settings given by the flags, the
+// environment and the config file.
+func newLoader() (*config.Loader, error) {
+	return config.NewLoader(cfgFile, settings, envconfig.OsLookuper())
 }
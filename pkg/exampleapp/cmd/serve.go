@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -17,7 +18,14 @@ var serveCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		exampleapp.PrintBanner()
 
-		myapp, err := exampleapp.New()
+		l, err := newLoader()
+		if err != nil {
+			log.Errorf("app config error:%v", err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		myapp, err := exampleapp.NewWith(ctx, l)
+		cancel()
 		if err != nil {
 			log.Errorf("app config error:%v", err)
 			return
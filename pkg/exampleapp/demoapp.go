@@ -4,24 +4,46 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"strings"
 	"time"
 
+	"github.com/jusongchen/REST-app/migration"
+	"github.com/jusongchen/REST-app/pkg/config"
 	"github.com/jusongchen/REST-app/pkg/logging"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/jusongchen/REST-app/pkg/rest/idempotency"
 	restapp "github.com/jusongchen/REST-app/pkg/rest/app"
+	"github.com/jusongchen/REST-app/pkg/rest/middleware"
+	"github.com/jusongchen/REST-app/pkg/task"
 	"github.com/sethvargo/go-envconfig"
+	"go.uber.org/zap/zapcore"
 )
 
+//dbStatsPath serves the connection pool statistics when DB_NAME is set
+const dbStatsPath = "/debug/db/pool"
+
 //specification has app config
 type specification struct {
 	RestConfig restapp.Config `json:"rest_config,omitempty"`
 
-	LogFormat string `env:"LOG_FORMAT,default=text" json:"log_format,omitempty" `
-	LogLevel  string `env:"LOG_LEVEL,default=INFO" json:"log_level,omitempty" `
+	//DB is used to store users when DB_NAME is set, otherwise users are kept in memory
+	DB postgres.Config `json:"db,omitempty"`
+
+	//MigrateOnStartup applies pending DB migrations before serving
+	MigrateOnStartup bool `env:"DB_MIGRATE_ON_STARTUP,default=false" json:"migrate_on_startup" info:"true"`
+
+	//Tasks tunes the workers running asynchronous tasks
+	Tasks task.Config `json:"tasks,omitempty"`
+
+	LogFormat string `env:"LOG_FORMAT,default=text" json:"log_format,omitempty" info:"true"`
+	LogLevel  string `env:"LOG_LEVEL,default=INFO" json:"log_level,omitempty" reload:"true" info:"true"`
+
+	//CORSOrigins may call the API from a browser, "*" allows any origin
+	CORSOrigins []string `env:"CORS_ALLOWED_ORIGINS" json:"cors_allowed_origins,omitempty" reload:"true" info:"true"`
 
 	//if set to true, start service but do not mount any RESTFUL resources
-	BootstrapMode bool `env:"BOOTSTRAP_MODE,default=false" json:"bootstrap_mode"`
+	BootstrapMode bool `env:"BOOTSTRAP_MODE,default=false" json:"bootstrap_mode" info:"true"`
 
 	//RootCAPath location of RootCA cert
 	RootCAPath     string `env:"ROOT_CA_PATH,default=/etc/identity/ca/cacerts.pem" json:"root_ca_path,omitempty"`
@@ -31,6 +53,29 @@ type specification struct {
 
 var _ fmt.Stringer = specification{}
 
+//Validate checks all settings of a and reports every problem found
+func (a specification) Validate() error {
+	var errs config.Errors
+	errs.Add(a.RestConfig.Validate())
+	if a.DB.Name != "" {
+		errs.Add(a.DB.Validate())
+	}
+	errs.Add(a.Tasks.Validate())
+	if a.LogFormat != "text" && a.LogFormat != "json" {
+		errs.Add(fmt.Errorf("LOG_FORMAT must be text or json, got %q", a.LogFormat))
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(a.LogLevel)); err != nil {
+		errs.Add(fmt.Errorf("LOG_LEVEL: %v", err))
+	}
+	for _, o := range a.CORSOrigins {
+		if o != "*" && !strings.Contains(o, "://") {
+			errs.Add(fmt.Errorf("CORS_ALLOWED_ORIGINS must be * or origins such as https://example.com, got %q", o))
+		}
+	}
+	return errs.Err()
+}
+
 //New init a new application
 func New() (*restapp.Instance, error) {
 	// log.Infof("Environment:%s", os.Environ())
@@ -45,51 +90,125 @@ func NewWith(ctx context.Context, l envconfig.Lookuper) (*restapp.Instance, erro
 	var spec specification
 	var err error
 
-	if err := envconfig.ProcessWith(ctx, &spec, l); err != nil {
+	if err := config.Load(ctx, l, &spec); err != nil {
 		return nil, err
 	}
 
+	if err := restapp.SetLogLevel(spec.LogLevel); err != nil {
+		return nil, err
+	}
 	logger := logging.DefaultLogger().Named("Demoapp")
 	logger.Infof(`App Specification: %s`, spec)
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("os.Getwd:%v", err)
+	store, keys, tasks := NewMemoryUserStore(), idempotency.NewMemoryStore(), task.NewMemoryStore()
+	var db *postgres.DB
+	var elector *postgres.Elector
+	if spec.DB.Name != "" {
+		db, err = postgres.NewFromEnv(ctx, &spec.DB)
+		if err != nil {
+			return nil, err
+		}
+		if spec.MigrateOnStartup {
+			if err := db.MigrateUp(ctx, &spec.DB, migration.FS); err != nil {
+				db.Close(ctx)
+				return nil, err
+			}
+		}
+		store = NewPostgresUserStore(db)
+		keys = idempotency.NewPostgresStore(db, time.Minute)
+		tasks = task.NewPostgresStore(db)
+
+		elector, err = db.NewElector(postgres.ElectorConfig{
+			Election:         maintenanceElection,
+			OnStartedLeading: runMaintenance(keys, maintenanceInterval),
+		})
+		if err != nil {
+			db.Close(ctx)
+			return nil, err
+		}
 	}
+	pool := task.NewPool(tasks, spec.Tasks)
+	pool.Register(awrReportTask, task.HandlerFunc(runAWRReport))
 
-	about := struct {
-		Release     string
-		BuildTime   string
-		Commit      string
-		Cwd         string
-		Spec        specification
-		EnvironVars string
-	}{
-		Release,
-		BuildTime,
-		Commit,
-		cwd,
-		spec,
-		strings.Join(os.Environ(), " "),
-	}
-	data, err := json.MarshalIndent(about, "", "  ")
-	if err != nil {
-		return nil, fmt.Errorf("error json marshal %+v: %v", about, err)
-
-	}
-	spec.RestConfig.About = string(data)
+	u := NewUserResource(store, keys)
+	t := task.NewResource(tasks, keys, pool.Types()...)
 
-	u := UserResource{users: map[string]User{}}
-
-	a, err := restapp.New(spec.RestConfig, info, u.WebService())
+	a, err := restapp.New(spec.RestConfig, info, u.WebService(), t.WebService())
 	if err != nil {
 		logger.Errorf("app init:%v", err)
+		if db != nil {
+			db.Close(ctx)
+		}
 		return nil, err
 	}
+	if db != nil {
+		// added first so that it is stopped last, after the components using it
+		a.AddComponent(dbComponent{db})
+	}
+	a.AddComponent(pool)
+
+	cors := middleware.NewCORS(spec.CORSOrigins...)
+	a.Container.Filter(cors.Filter)
+
+	var file string
+	if loader, ok := l.(*config.Loader); ok {
+		file = loader.File()
+	}
+	reloader := newSpecReloader(l, spec,
+		func(spec specification) error { return restapp.SetLogLevel(spec.LogLevel) },
+		func(spec specification) error { cors.SetOrigins(spec.CORSOrigins); return nil },
+	)
+	a.SetReloader(reloader, file)
+	a.SetInfo(restapp.ReadBuildInfo(Release, Commit, BuildTime), reloader.Settings)
+	a.AddStatus("config_reload", func() interface{} { return a.LastReload() })
+
+	if db != nil {
+		a.AddStatus("db_pool", func() interface{} { return db.Stats() })
+		a.HandleAdmin(dbStatsPath, db.StatsHandler())
+	}
+	if elector != nil {
+		a.AddComponent(elector)
+		// give up the leadership on shutdown before draining the requests, not after
+		a.OnShutdown(elector.Stop)
+		a.AddStatus("leader_election", func() interface{} { return elector.Status() })
+	}
 
 	return a, nil
 }
 
+//dbComponent closes the connection pool of db as the app stops
+type dbComponent struct {
+	db *postgres.DB
+}
+
+//Start does nothing, the pool is open already
+func (c dbComponent) Start() error { return nil }
+
+//Stop closes the pool
+func (c dbComponent) Stop(ctx context.Context) error {
+	c.db.Close(ctx)
+	return nil
+}
+
+//PrintConfig writes the effective configuration loaded from l to w, one
+//KEY=value per line, with secrets masked and, if l is a *config.Loader, the
+//source of each setting. It returns the validation errors of the configuration
+func PrintConfig(ctx context.Context, l envconfig.Lookuper, w io.Writer) error {
+	var spec specification
+	if err := envconfig.ProcessWith(ctx, &spec, l); err != nil {
+		return err
+	}
+	loader, _ := l.(*config.Loader)
+	for _, s := range config.Settings(spec) {
+		if loader != nil {
+			fmt.Fprintf(w, "%s=%s\t# %s\n", s.Key, s.Value, loader.Source(s.Key))
+			continue
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.Key, s.Value)
+	}
+	return spec.Validate()
+}
+
 func (a specification) String() string {
 	b, _ := json.MarshalIndent(a, "", "  ")
 	return string(b)
@@ -3,11 +3,18 @@ package exampleapp
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jusongchen/REST-app/pkg/config"
+	"github.com/jusongchen/REST-app/pkg/logging"
+	restapp "github.com/jusongchen/REST-app/pkg/rest/app"
 	"github.com/sethvargo/go-envconfig"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestApp_Run_LocalDevNoDBNoAuthN(t *testing.T) {
@@ -25,7 +32,7 @@ func TestApp_Run_LocalDevNoDBNoAuthN(t *testing.T) {
 
 		a.Start()
 		defer a.Close()
-		baseURL := a.Svr.URL
+		baseURL := a.Svr.URLs[0]
 
 		paths := []string{
 			"/home",
@@ -58,3 +65,141 @@ func LocalDevEnv(tb testing.TB) map[string]string {
 
 	return env
 }
+
+func TestNewWith_InvalidConfig(t *testing.T) {
+	env := LocalDevEnv(t)
+	env["LOG_FORMAT"] = "xml"
+	env["HOST"] = "not an ip"
+	env["TASK_CONCURRENCY"] = "-1"
+
+	_, err := NewWith(context.Background(), envconfig.MapLookuper(env))
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 3, err.Error())
+}
+
+func TestPrintConfig(t *testing.T) {
+	env := LocalDevEnv(t)
+	env["DB_PASSWORD"] = "hunter2"
+	l, err := config.NewLoader("", []string{"PORT=8080"}, envconfig.MapLookuper(env))
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, PrintConfig(context.Background(), l, &out))
+
+	require.NotContains(t, out.String(), "hunter2")
+	for _, line := range []string{
+		"DB_PASSWORD=********\t# env",
+		"PORT=8080\t# flag",
+		"HOST=127.0.0.1\t# env",
+		"SHUTDOWN_TIMEOUT=30s\t# default",
+	} {
+		require.Contains(t, out.String(), line+"\n")
+	}
+}
+
+func TestNewWith_Reload(t *testing.T) {
+	env := LocalDevEnv(t)
+	a, err := NewWith(context.Background(), envconfig.MapLookuper(env))
+	require.NoError(t, err)
+	defer restapp.SetLogLevel("INFO")
+
+	corsOrigin := func() string {
+		req := httptest.NewRequest(http.MethodGet, userResourceRootPath, nil)
+		req.Header.Set("Origin", "https://ui.example.com")
+		rec := httptest.NewRecorder()
+		a.Container.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+	require.Empty(t, corsOrigin())
+
+	env["LOG_LEVEL"] = "debug"
+	env["CORS_ALLOWED_ORIGINS"] = "https://ui.example.com"
+	env["PORT"] = "8080"
+	res, ok := a.Reload("test")
+	require.True(t, ok)
+	require.Empty(t, res.Error)
+
+	var applied, rejected []string
+	for _, c := range res.Applied {
+		applied = append(applied, c.Key)
+	}
+	for _, c := range res.Rejected {
+		rejected = append(rejected, c.Key)
+	}
+	require.Equal(t, []string{"LOG_LEVEL", "CORS_ALLOWED_ORIGINS"}, applied)
+	require.Equal(t, []string{"PORT"}, rejected)
+	require.Equal(t, zapcore.DebugLevel, logging.GetDefaultLogLevel())
+	require.Equal(t, log.DebugLevel, log.GetLevel(), "the server log follows a reload")
+	require.Equal(t, "https://ui.example.com", corsOrigin())
+
+	env["LOG_FORMAT"] = "xml"
+	res, _ = a.Reload("test")
+	require.Contains(t, res.Error, "LOG_FORMAT")
+	require.Equal(t, zapcore.DebugLevel, logging.GetDefaultLogLevel())
+}
+
+func TestNewWith_NoSecretsServed(t *testing.T) {
+	env := LocalDevEnv(t)
+	env["DB_PASSWORD"] = "hunter2"
+	env["ADMIN_TOKEN"] = "s3cret"
+	a, err := NewWith(context.Background(), envconfig.MapLookuper(env))
+	require.NoError(t, err)
+
+	for _, auth := range []string{"", "Bearer s3cret"} {
+		for _, path := range []string{"/home", "/info"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			rec := httptest.NewRecorder()
+			a.Container.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code, path)
+			require.NotContains(t, rec.Body.String(), "hunter2", path)
+			require.NotContains(t, rec.Body.String(), "s3cret", path)
+		}
+	}
+}
+
+func TestNewWith_RuntimeInfo(t *testing.T) {
+	env := LocalDevEnv(t)
+	env["ADMIN_TOKEN"] = "s3cret"
+	a, err := NewWith(context.Background(), envconfig.MapLookuper(env))
+	require.NoError(t, err)
+
+	get := func(path, auth string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		a.Container.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		return rec.Body.String()
+	}
+
+	require.NotContains(t, get("/home", ""), "config_reload", "statuses are not public")
+	require.NotContains(t, get("/info", ""), "LOG_LEVEL", "settings are not public")
+
+	require.Contains(t, get("/home", "Bearer s3cret"), "config_reload")
+	body := get("/info", "Bearer s3cret")
+	require.Contains(t, body, `"LOG_LEVEL"`)
+	require.NotContains(t, body, "ROOT_CA_PATH", "only the settings tagged info are shown")
+	require.NotContains(t, body, "ADMIN_TOKEN")
+}
+
+func TestNewWith_UserBodyLimit(t *testing.T) {
+	a, err := NewWith(context.Background(), envconfig.MapLookuper(LocalDevEnv(t)))
+	require.NoError(t, err)
+
+	post := func(name string) int {
+		body := strings.NewReader(`{"name":"` + name + `","age":21}`)
+		req := httptest.NewRequest(http.MethodPost, userResourceRootPath+"/", body)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		a.Container.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusCreated, post("john"))
+	require.Equal(t, http.StatusRequestEntityTooLarge, post(strings.Repeat("x", int(userMaxBodyBytes))))
+}
@@ -0,0 +1,41 @@
+package exampleapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/logging"
+	"github.com/jusongchen/REST-app/pkg/rest/idempotency"
+)
+
+const (
+	// maintenanceElection elects the replica running maintenance jobs.
+	maintenanceElection = "exampleapp/maintenance"
+
+	maintenanceInterval = 10 * time.Minute
+)
+
+// runMaintenance returns a job purging expired idempotency keys every
+// interval until ctx is done. Only the leader of maintenanceElection runs it.
+func runMaintenance(keys idempotency.Store, interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		logger := logging.DefaultLogger().Named("Maintenance")
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := keys.DeleteExpired(ctx)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				logger.Errorf("purging expired idempotency keys: %v", err)
+			case n > 0:
+				logger.Infof("purged %d expired idempotency keys", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package exampleapp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jusongchen/REST-app/pkg/config"
+	restapp "github.com/jusongchen/REST-app/pkg/rest/app"
+	"github.com/sethvargo/go-envconfig"
+)
+
+//subscriber applies the reloadable settings of spec to a running component
+type subscriber func(spec specification) error
+
+//specReloader loads the specification again and hands its reloadable settings to subscribers.
+//restapp.Instance runs one reload at a time
+type specReloader struct {
+	lookuper    envconfig.Lookuper
+	subscribers []subscriber
+
+	mu      sync.Mutex
+	current specification
+}
+
+var _ restapp.Reloader = (*specReloader)(nil)
+
+func newSpecReloader(l envconfig.Lookuper, current specification, subscribers ...subscriber) *specReloader {
+	return &specReloader{lookuper: l, current: current, subscribers: subscribers}
+}
+
+//Reload implements restapp.Reloader. The config file, if any, is read again
+func (r *specReloader) Reload(ctx context.Context) restapp.ReloadResult {
+	var res restapp.ReloadResult
+
+	l := r.lookuper
+	if loader, ok := l.(*config.Loader); ok {
+		reloaded, err := loader.Reload()
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		l = reloaded
+	}
+	var next specification
+	if err := config.Load(ctx, l, &next); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	r.mu.Lock()
+	current := r.current
+	r.mu.Unlock()
+
+	for _, c := range config.Diff(current, next) {
+		if c.Reloadable {
+			res.Applied = append(res.Applied, c)
+		} else {
+			res.Rejected = append(res.Rejected, c)
+		}
+	}
+	if len(res.Applied) == 0 {
+		return res
+	}
+
+	spec := current
+	config.CopyReloadable(&spec, next)
+	var errs config.Errors
+	for _, s := range r.subscribers {
+		errs.Add(s(spec))
+	}
+	r.mu.Lock()
+	r.current = spec
+	r.mu.Unlock()
+	if err := errs.Err(); err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+//Settings lists the settings in effect which may be shown at runtime, see config.InfoSettings
+func (r *specReloader) Settings() []config.Setting {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return config.InfoSettings(r.current)
+}
@@ -1,32 +1,64 @@
 package exampleapp
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/emicklei/go-restful"
 	restfulspec "github.com/emicklei/go-restful-openapi"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	restapp "github.com/jusongchen/REST-app/pkg/rest/app"
+	"github.com/jusongchen/REST-app/pkg/rest/idempotency"
 	"github.com/jusongchen/REST-app/pkg/rest/middleware"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
 )
 
 const (
 	userResourceRootPath = "/api/v1/users"
+
+	//userMaxBodyBytes bounds the request bodies of the routes writing a user
+	userMaxBodyBytes int64 = 64 << 10
 )
 
 // User is a User Domain type
 type User struct {
-	ID   string `json:"id" description:"identifier of the user"`
+	ID   string `json:"id" description:"identifier of the user, generated by the server"`
 	Name string `json:"name" description:"name of the user" default:"john"`
 	Age  int    `json:"age" description:"age of the user" default:"21"`
+
+	// Version is incremented on every change and served as the ETag.
+	Version int64 `json:"-"`
+}
+
+func (u User) validate() error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	if u.Age < 0 {
+		return errors.New("age must not be negative")
+	}
+	return nil
 }
 
 // UserResource is the REST layer to the User domain
 type UserResource struct {
-	// normally one would use DAO (data access object)
-	users map[string]User
+	store UserStore
+	keys  idempotency.Store
+}
+
+// NewUserResource returns a UserResource backed by store. Responses to requests
+// with an Idempotency-Key header are kept in keys; if keys is nil the header
+// is ignored.
+func NewUserResource(store UserStore, keys idempotency.Store) *UserResource {
+	return &UserResource{store: store, keys: keys}
 }
 
 // WebService creates a new service that can handle REST requests for User resources.
-func (u UserResource) WebService() *restful.WebService {
+func (u *UserResource) WebService() *restful.WebService {
 	ws := new(restful.WebService)
 	ws.
 		Path(userResourceRootPath).
@@ -36,67 +68,384 @@ func (u UserResource) WebService() *restful.WebService {
 	// install webservice filters
 	ws.Filter(middleware.RequestIDRest)
 	ws.Filter(middleware.Logging)
+	if u.keys != nil {
+		ws.Filter(idempotency.Filter(u.keys))
+	}
 
 	tags := []string{"users"}
+	linkHeader := map[string]restful.Header{
+		"Link": {Items: &restful.Items{Type: "string"}, Description: `first and next page links, RFC 8288`},
+	}
+	locationHeader := map[string]restful.Header{
+		"Location": {Items: &restful.Items{Type: "string"}, Description: "URL of the created user"},
+		"ETag":     {Items: &restful.Items{Type: "string"}, Description: "version of the user"},
+	}
+	etagHeader := map[string]restful.Header{
+		"ETag": {Items: &restful.Items{Type: "string"}, Description: "version of the user"},
+	}
+	ifMatch := ws.HeaderParameter("If-Match", "ETag of the version this change is based on, or *").DataType("string").Required(true)
+	idempotencyKey := ws.HeaderParameter(idempotency.KeyHeader, "client chosen unique key; a retried request with the same key gets the original response").DataType("string")
 
 	ws.Route(ws.GET("/").To(u.findAllUsers).
 		// docs
-		Doc("get all users").
+		Doc("list users").
+		Notes(`Users are returned one page at a time. The Link response header carries the URL of the first page and, if there is one, of the next page.`).
+		Param(ws.QueryParameter("name", "only return users with this name, case insensitive").DataType("string")).
+		Param(ws.QueryParameter("min_age", "only return users at least this old").DataType("integer")).
+		Param(ws.QueryParameter("max_age", "only return users at most this old").DataType("integer")).
+		Param(ws.QueryParameter(resource.SortParam, "comma separated fields to sort by, prefix a field with - for descending order: id, name, age").DataType("string").DefaultValue("id")).
+		Param(ws.QueryParameter(resource.LimitParam, fmt.Sprintf("page size, at most %d", resource.MaxPageSize)).DataType("integer").DefaultValue(strconv.Itoa(resource.DefaultPageSize))).
+		Param(ws.QueryParameter(resource.CursorParam, "opaque cursor taken from a Link header").DataType("string")).
 		Metadata(restfulspec.KeyOpenAPITags, tags).
 		Writes([]User{}).
-		Returns(200, "OK", []User{}))
+		ReturnsWithHeaders(200, "OK", []User{}, linkHeader).
+		Returns(400, "Bad Request", nil))
+
+	ws.Route(ws.POST("/").To(u.createUser).
+		// docs
+		Doc("create a user").
+		Notes("The ID is generated by the server; an ID in the request body is ignored.").
+		Param(idempotencyKey).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Metadata(restapp.KeyMaxBodyBytes, userMaxBodyBytes).
+		Reads(User{}).
+		Writes(User{}).
+		ReturnsWithHeaders(201, "Created", User{}, locationHeader).
+		Returns(400, "Bad Request", nil).
+		Returns(413, "Request Entity Too Large", nil).
+		Returns(422, "Idempotency-Key reused for a different request", nil))
 
 	ws.Route(ws.GET("/{user-id}").To(u.findUser).
 		// docs
 		Doc("get a user").
-		Param(ws.PathParameter("user-id", "identifier of the user").DataType("integer").DefaultValue("1")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.HeaderParameter("If-None-Match", "ETag of a cached version").DataType("string")).
 		Metadata(restfulspec.KeyOpenAPITags, tags).
 		Writes(User{}). // on the response
-		Returns(200, "OK", User{}).
+		ReturnsWithHeaders(200, "OK", User{}, etagHeader).
+		Returns(304, "Not Modified", nil).
 		Returns(404, "Not Found", nil))
 
 	ws.Route(ws.PUT("/{user-id}").To(u.updateUser).
 		// docs
-		Doc("update a user").
+		Doc("replace a user").
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ifMatch).
+		Param(idempotencyKey).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Metadata(restapp.KeyMaxBodyBytes, userMaxBodyBytes).
+		Reads(User{}). // from the request
+		Writes(User{}).
+		ReturnsWithHeaders(200, "OK", User{}, etagHeader).
+		Returns(400, "Bad Request", nil).
+		Returns(404, "Not Found", nil).
+		Returns(412, "Precondition Failed", nil).
+		Returns(413, "Request Entity Too Large", nil).
+		Returns(422, "Idempotency-Key reused for a different request", nil).
+		Returns(428, "Precondition Required", nil))
+
+	ws.Route(ws.PATCH("/{user-id}").To(u.patchUser).
+		// docs
+		Doc("update a user with a JSON Merge Patch").
+		Notes("The request body is a JSON Merge Patch document (RFC 7386). The ID cannot be changed.").
+		Consumes(resource.MIMEMergePatch, restful.MIME_JSON).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ifMatch).
+		Param(idempotencyKey).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Metadata(restapp.KeyMaxBodyBytes, userMaxBodyBytes).
+		Reads(User{}).
+		Writes(User{}).
+		ReturnsWithHeaders(200, "OK", User{}, etagHeader).
+		Returns(400, "Bad Request", nil).
+		Returns(404, "Not Found", nil).
+		Returns(412, "Precondition Failed", nil).
+		Returns(413, "Request Entity Too Large", nil).
+		Returns(422, "Idempotency-Key reused for a different request", nil).
+		Returns(428, "Precondition Required", nil))
+
+	ws.Route(ws.DELETE("/{user-id}").To(u.deleteUser).
+		// docs
+		Doc("delete a user").
 		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ifMatch).
+		Param(idempotencyKey).
 		Metadata(restfulspec.KeyOpenAPITags, tags).
-		Reads(User{})) // from the request
+		Returns(204, "No Content", nil).
+		Returns(404, "Not Found", nil).
+		Returns(412, "Precondition Failed", nil).
+		Returns(422, "Idempotency-Key reused for a different request", nil).
+		Returns(428, "Precondition Required", nil))
 
 	return ws
 }
 
-// GET http://localhost:8080/users
+// GET http://localhost:8080/api/v1/users/?name=john&min_age=18&sort=-age,name&limit=10
 //
-func (u UserResource) findAllUsers(request *restful.Request, response *restful.Response) {
-	list := []User{}
-	for _, each := range u.users {
-		list = append(list, each)
+func (u *UserResource) findAllUsers(request *restful.Request, response *restful.Response) {
+	q, err := parseUserQuery(request)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
 	}
+
+	list, more, err := u.store.List(request.Request.Context(), q)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+
+	var next *resource.Cursor
+	if more {
+		next = &resource.Cursor{Sort: q.Sort.String(), Key: userSortKey(list[len(list)-1], q.Sort)}
+	}
+	resource.SetLinks(response.Header(), request.Request.URL, q.Limit, next)
 	response.WriteEntity(list)
 }
 
-// GET http://localhost:8080/users/1
+func parseUserQuery(request *restful.Request) (UserQuery, error) {
+	var q UserQuery
+	var err error
+
+	values := request.Request.URL.Query()
+	if q.Sort, err = resource.ParseSort(values.Get(resource.SortParam), defaultUserSort, userSortFields...); err != nil {
+		return q, err
+	}
+	if q.Page, err = resource.ParsePage(values, q.Sort); err != nil {
+		return q, err
+	}
+	if q.Cursor != nil {
+		if _, err := userFromKey(q.Cursor.Key, q.Sort); err != nil {
+			return q, err
+		}
+	}
+
+	q.Filter.Name = values.Get("name")
+	if q.Filter.MinAge, err = intParam(values.Get("min_age"), "min_age"); err != nil {
+		return q, err
+	}
+	if q.Filter.MaxAge, err = intParam(values.Get("max_age"), "max_age"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func intParam(v, name string) (*int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+	return &n, nil
+}
+
+// POST http://localhost:8080/api/v1/users/
+// {"name":"Melissa Raspberry","age":30}
 //
-func (u UserResource) findUser(request *restful.Request, response *restful.Response) {
-	id := request.PathParameter("user-id")
-	usr := u.users[id]
-	if len(usr.ID) == 0 {
-		response.WriteErrorString(http.StatusNotFound, "User could not be found.")
-	} else {
-		response.WriteEntity(usr)
+func (u *UserResource) createUser(request *restful.Request, response *restful.Response) {
+	usr := User{}
+	if err := request.ReadEntity(&usr); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := usr.validate(); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := u.store.Create(request.Request.Context(), usr)
+	if err != nil {
+		writeUserError(response, err)
+		return
 	}
+	response.AddHeader("Location", userResourceRootPath+"/"+created.ID)
+	response.AddHeader("ETag", resource.VersionETag(created.Version))
+	response.WriteHeaderAndEntity(http.StatusCreated, created)
 }
 
-// PUT http://localhost:8080/users/1
-// <User><Id>1</Id><Name>Melissa Raspberry</Name></User>
+// GET http://localhost:8080/api/v1/users/1
+//
+func (u *UserResource) findUser(request *restful.Request, response *restful.Response) {
+	usr, err := u.store.Get(request.Request.Context(), request.PathParameter("user-id"))
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+
+	etag := resource.VersionETag(usr.Version)
+	response.AddHeader("ETag", etag)
+	if resource.NotModified(request.Request, etag) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.WriteEntity(usr)
+}
+
+// PUT http://localhost:8080/api/v1/users/1
+// If-Match: "1"
+// {"name":"Melissa Raspberry","age":30}
 //
 func (u *UserResource) updateUser(request *restful.Request, response *restful.Response) {
-	usr := new(User)
-	err := request.ReadEntity(&usr)
-	if err == nil {
-		u.users[usr.ID] = *usr
-		response.WriteEntity(usr)
-	} else {
+	id := request.PathParameter("user-id")
+	version, err := u.ifMatchVersion(request.Request, id)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+
+	usr := User{}
+	if err := request.ReadEntity(&usr); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	if usr.ID != "" && usr.ID != id {
+		response.WriteErrorString(http.StatusBadRequest, "user ID in body does not match the URL")
+		return
+	}
+	usr.ID = id
+	usr.Version = version
+	if err := usr.validate(); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := u.store.Update(request.Request.Context(), usr)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+	response.AddHeader("ETag", resource.VersionETag(updated.Version))
+	response.WriteEntity(updated)
+}
+
+// PATCH http://localhost:8080/api/v1/users/1
+// Content-Type: application/merge-patch+json
+// If-Match: "1"
+// {"age":31}
+//
+func (u *UserResource) patchUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	id := request.PathParameter("user-id")
+	versions, err := resource.IfMatchVersions(request.Request)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+
+	patch, err := ioutil.ReadAll(request.Request.Body)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	usr, err := u.store.Get(ctx, id)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+	// The patch is applied to the version read above, so the update must be
+	// based on it even for "If-Match: *".
+	if !resource.MatchesVersion(versions, usr.Version) {
+		writeUserError(response, ErrUserVersionConflict)
+		return
+	}
+	version := usr.Version
+
+	doc, err := json.Marshal(usr)
+	if err != nil {
+		response.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	patched, err := resource.MergePatch(doc, patch)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	usr = User{}
+	if err := json.Unmarshal(patched, &usr); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	if usr.ID != id {
+		response.WriteErrorString(http.StatusBadRequest, "user ID cannot be changed")
+		return
+	}
+	usr.Version = version
+	if err := usr.validate(); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := u.store.Update(ctx, usr)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+	response.AddHeader("ETag", resource.VersionETag(updated.Version))
+	response.WriteEntity(updated)
+}
+
+// DELETE http://localhost:8080/api/v1/users/1
+// If-Match: "1"
+//
+func (u *UserResource) deleteUser(request *restful.Request, response *restful.Response) {
+	id := request.PathParameter("user-id")
+	version, err := u.ifMatchVersion(request.Request, id)
+	if err != nil {
+		writeUserError(response, err)
+		return
+	}
+	if err := u.store.Delete(request.Request.Context(), id, version); err != nil {
+		writeUserError(response, err)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// ifMatchVersion returns the version of user id the write of r is conditional
+// on, see resource.IfMatchVersions. When If-Match lists several versions, the
+// stored one must be among them and the write is then conditional on it, so
+// that the user cannot change in between.
+func (u *UserResource) ifMatchVersion(r *http.Request, id string) (int64, error) {
+	versions, err := resource.IfMatchVersions(r)
+	if err != nil {
+		return 0, err
+	}
+	switch len(versions) {
+	case 0:
+		return -1, nil
+	case 1:
+		return versions[0], nil
+	}
+	usr, err := u.store.Get(r.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+	if !resource.MatchesVersion(versions, usr.Version) {
+		return 0, ErrUserVersionConflict
+	}
+	return usr.Version, nil
+}
+
+// writeUserError maps store errors to HTTP responses.
+func writeUserError(response *restful.Response, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		response.WriteErrorString(http.StatusNotFound, "User could not be found.")
+	case errors.Is(err, ErrUserVersionConflict):
+		response.WriteErrorString(http.StatusPreconditionFailed, "User has been modified, fetch it again to get its current ETag.")
+	case errors.Is(err, resource.ErrPreconditionRequired):
+		response.WriteErrorString(http.StatusPreconditionRequired, err.Error())
+	case errors.Is(err, resource.ErrInvalidIfMatch):
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+	default:
+		if status, ok := postgres.HTTPStatus(err); ok {
+			response.WriteErrorString(status, http.StatusText(status))
+			return
+		}
 		response.WriteError(http.StatusInternalServerError, err)
 	}
 }
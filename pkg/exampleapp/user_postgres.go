@@ -0,0 +1,228 @@
+package exampleapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+)
+
+// userColumns maps sortable user fields to their column.
+var userColumns = map[string]string{
+	"id":   "id",
+	"name": "name",
+	"age":  "age",
+}
+
+// postgresUserStore keeps users in the users table.
+type postgresUserStore struct {
+	db *postgres.DB
+}
+
+// NewPostgresUserStore returns a UserStore backed by db.
+func NewPostgresUserStore(db *postgres.DB) UserStore {
+	return &postgresUserStore{db: db}
+}
+
+// queryArgs collects positional query arguments.
+type queryArgs []interface{}
+
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+func (s *postgresUserStore) List(ctx context.Context, q UserQuery) ([]User, bool, error) {
+	var args queryArgs
+	var where []string
+
+	if q.Filter.Name != "" {
+		where = append(where, "lower(name) = lower("+args.add(q.Filter.Name)+")")
+	}
+	if q.Filter.MinAge != nil {
+		where = append(where, "age >= "+args.add(*q.Filter.MinAge))
+	}
+	if q.Filter.MaxAge != nil {
+		where = append(where, "age <= "+args.add(*q.Filter.MaxAge))
+	}
+	if q.Cursor != nil {
+		after, err := userFromKey(q.Cursor.Key, q.Sort)
+		if err != nil {
+			return nil, false, err
+		}
+		where = append(where, keysetCondition(q.Sort, after, &args))
+	}
+
+	var order []string
+	for _, f := range q.Sort {
+		order = append(order, userColumns[f.Name]+direction(f.Desc))
+	}
+	order = append(order, "id ASC")
+
+	sql := "SELECT id, name, age, version FROM users"
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += " ORDER BY " + strings.Join(order, ", ") + " LIMIT " + args.add(q.Limit+1)
+
+	// Listings tolerate replication lag.
+	rows, err := s.db.Reader().Query(ctx, sql, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("listing users: %w", postgres.Classify(err))
+	}
+	defer rows.Close()
+
+	list := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Age, &u.Version); err != nil {
+			return nil, false, fmt.Errorf("listing users: %w", postgres.Classify(err))
+		}
+		list = append(list, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("listing users: %w", postgres.Classify(err))
+	}
+
+	if len(list) > q.Limit {
+		return list[:q.Limit], true, nil
+	}
+	return list, false, nil
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+// keysetCondition returns the WHERE clause selecting the rows that sort after
+// the user after, e.g. for "name,-age":
+//
+//	(name > $1) OR (name = $1 AND age < $2) OR (name = $1 AND age = $2 AND id > $3)
+func keysetCondition(s resource.Sort, after User, args *queryArgs) string {
+	keys := append(resource.Sort{}, s...)
+	keys = append(keys, resource.SortField{Name: "id"})
+
+	values := map[string]string{}
+	value := func(name string) string {
+		if v, ok := values[name]; ok {
+			return v
+		}
+		var p string
+		switch name {
+		case "id":
+			p = args.add(after.ID)
+		case "name":
+			p = args.add(after.Name)
+		case "age":
+			p = args.add(after.Age)
+		}
+		values[name] = p
+		return p
+	}
+
+	var or []string
+	for i, k := range keys {
+		var and []string
+		for _, eq := range keys[:i] {
+			and = append(and, userColumns[eq.Name]+" = "+value(eq.Name))
+		}
+		op := " > "
+		if k.Desc {
+			op = " < "
+		}
+		and = append(and, userColumns[k.Name]+op+value(k.Name))
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return "(" + strings.Join(or, " OR ") + ")"
+}
+
+func (s *postgresUserStore) Get(ctx context.Context, id string) (User, error) {
+	u := User{ID: id}
+	row := s.db.Pool.QueryRow(ctx, `
+		SELECT name, age, version FROM users WHERE id = $1
+	`, id)
+	if err := row.Scan(&u.Name, &u.Age, &u.Version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("reading user %q: %w", id, postgres.Classify(err))
+	}
+	return u, nil
+}
+
+func (s *postgresUserStore) Create(ctx context.Context, u User) (User, error) {
+	id, err := newUserID()
+	if err != nil {
+		return User{}, err
+	}
+	u.ID = id
+	u.Version = 1
+
+	if _, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO users (id, name, age, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, now(), now())
+	`, u.ID, u.Name, u.Age, u.Version); err != nil {
+		return User{}, fmt.Errorf("creating user: %w", postgres.Classify(err))
+	}
+	return u, nil
+}
+
+func (s *postgresUserStore) Update(ctx context.Context, u User) (User, error) {
+	err := s.db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		stored, err := lockUserVersion(ctx, tx, u.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(stored, u.Version); err != nil {
+			return err
+		}
+
+		u.Version = stored + 1
+		_, err = tx.Exec(ctx, `
+			UPDATE users SET name = $2, age = $3, version = $4, updated_at = now()
+			WHERE id = $1
+		`, u.ID, u.Name, u.Age, u.Version)
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func (s *postgresUserStore) Delete(ctx context.Context, id string, version int64) error {
+	return s.db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		stored, err := lockUserVersion(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(stored, version); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+		return err
+	})
+}
+
+// lockUserVersion locks the user row for the rest of tx and returns its version.
+func lockUserVersion(ctx context.Context, tx pgx.Tx, id string) (int64, error) {
+	var version int64
+	row := tx.QueryRow(ctx, `
+		SELECT version FROM users WHERE id = $1 FOR UPDATE
+	`, id)
+	if err := row.Scan(&version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, fmt.Errorf("reading user %q: %w", id, postgres.Classify(err))
+	}
+	return version, nil
+}
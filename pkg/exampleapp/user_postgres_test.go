@@ -0,0 +1,67 @@
+package exampleapp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresUserStore(t *testing.T) {
+	t.Parallel()
+
+	store := NewPostgresUserStore(postgres.NewTestDatabase(t))
+	ctx := context.Background()
+
+	var ids []string
+	for i, name := range []string{"amy", "bob", "cat", "dan", "eve"} {
+		u, err := store.Create(ctx, User{Name: name, Age: 20 + i%2})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), u.Version)
+		ids = append(ids, u.ID)
+	}
+
+	// Page through users sorted by descending age, then name.
+	sort := resource.Sort{{Name: "age", Desc: true}, {Name: "name"}}
+	var names []string
+	q := UserQuery{Sort: sort, Page: resource.Page{Limit: 2}}
+	for {
+		list, more, err := store.List(ctx, q)
+		require.NoError(t, err)
+		for _, u := range list {
+			names = append(names, u.Name)
+		}
+		if !more {
+			break
+		}
+		q.Cursor = &resource.Cursor{Sort: sort.String(), Key: userSortKey(list[len(list)-1], sort)}
+	}
+	require.Equal(t, []string{"bob", "dan", "amy", "cat", "eve"}, names)
+
+	minAge := 21
+	list, _, err := store.List(ctx, UserQuery{Filter: UserFilter{Name: "BOB", MinAge: &minAge}, Sort: defaultUserSort, Page: resource.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	u, err := store.Get(ctx, ids[0])
+	require.NoError(t, err)
+	u.Age = 50
+	updated, err := store.Update(ctx, u)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), updated.Version)
+
+	// u still carries version 1.
+	if _, err := store.Update(ctx, u); !errors.Is(err, ErrUserVersionConflict) {
+		t.Fatalf("got %v, wanted ErrUserVersionConflict", err)
+	}
+	if err := store.Delete(ctx, ids[0], 1); !errors.Is(err, ErrUserVersionConflict) {
+		t.Fatalf("got %v, wanted ErrUserVersionConflict", err)
+	}
+	require.NoError(t, store.Delete(ctx, ids[0], resource.AnyVersion))
+	if _, err := store.Get(ctx, ids[0]); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got %v, wanted ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,247 @@
+package exampleapp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+)
+
+var (
+	// ErrUserNotFound is returned when a user does not exist.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrUserVersionConflict is returned when a user was modified since the
+	// version an update or delete was based on.
+	ErrUserVersionConflict = errors.New("user has been modified")
+)
+
+var (
+	// userSortFields lists the fields a user listing can be sorted by.
+	userSortFields = []string{"id", "name", "age"}
+	// defaultUserSort orders users by ID.
+	defaultUserSort = resource.Sort{{Name: "id"}}
+)
+
+// UserFilter restricts a user listing. Zero values do not filter.
+type UserFilter struct {
+	Name   string
+	MinAge *int
+	MaxAge *int
+}
+
+func (f UserFilter) match(u User) bool {
+	if f.Name != "" && !strings.EqualFold(f.Name, u.Name) {
+		return false
+	}
+	if f.MinAge != nil && u.Age < *f.MinAge {
+		return false
+	}
+	if f.MaxAge != nil && u.Age > *f.MaxAge {
+		return false
+	}
+	return true
+}
+
+// UserQuery describes one page of a user listing.
+type UserQuery struct {
+	Filter UserFilter
+	Sort   resource.Sort
+	resource.Page
+}
+
+// UserStore persists users.
+type UserStore interface {
+	// List returns the page of users selected by q, and whether more follow.
+	List(ctx context.Context, q UserQuery) ([]User, bool, error)
+	Get(ctx context.Context, id string) (User, error)
+	// Create stores u under a newly generated ID, at version 1.
+	Create(ctx context.Context, u User) (User, error)
+	// Update replaces the stored user with the same ID and increments its
+	// version. It fails with ErrUserVersionConflict unless u.Version is the
+	// stored version or resource.AnyVersion.
+	Update(ctx context.Context, u User) (User, error)
+	// Delete removes a user, under the same version check as Update.
+	Delete(ctx context.Context, id string, version int64) error
+}
+
+// checkVersion compares the version a change is based on to the stored one.
+func checkVersion(stored, expected int64) error {
+	if expected != resource.AnyVersion && expected != stored {
+		return ErrUserVersionConflict
+	}
+	return nil
+}
+
+// userSortKey returns the cursor key of u for sort s: the sort field values
+// followed by the ID, which breaks ties.
+func userSortKey(u User, s resource.Sort) []string {
+	key := make([]string, 0, len(s)+1)
+	for _, f := range s {
+		switch f.Name {
+		case "id":
+			key = append(key, u.ID)
+		case "name":
+			key = append(key, u.Name)
+		case "age":
+			key = append(key, strconv.Itoa(u.Age))
+		}
+	}
+	return append(key, u.ID)
+}
+
+// compareUsers orders a before b (negative), after b (positive) or equal (0)
+// according to s, using the ID as the final ascending tie breaker.
+func compareUsers(a, b User, s resource.Sort) int {
+	for _, f := range s {
+		var c int
+		switch f.Name {
+		case "id":
+			c = strings.Compare(a.ID, b.ID)
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		case "age":
+			c = a.Age - b.Age
+		}
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// userFromKey rebuilds the sort relevant fields of a user from a cursor key.
+func userFromKey(key []string, s resource.Sort) (User, error) {
+	var u User
+	if len(key) != len(s)+1 {
+		return u, errors.New("cursor does not match sort order")
+	}
+	for i, f := range s {
+		switch f.Name {
+		case "name":
+			u.Name = key[i]
+		case "age":
+			age, err := strconv.Atoi(key[i])
+			if err != nil {
+				return u, errors.New("invalid age in cursor")
+			}
+			u.Age = age
+		}
+	}
+	u.ID = key[len(s)]
+	return u, nil
+}
+
+// newUserID returns a random user ID.
+func newUserID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// memoryUserStore keeps users in memory. It is used when no database is configured.
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+// NewMemoryUserStore returns a UserStore which keeps users in memory.
+func NewMemoryUserStore() UserStore {
+	return &memoryUserStore{users: map[string]User{}}
+}
+
+func (m *memoryUserStore) List(ctx context.Context, q UserQuery) ([]User, bool, error) {
+	var after *User
+	if q.Cursor != nil {
+		u, err := userFromKey(q.Cursor.Key, q.Sort)
+		if err != nil {
+			return nil, false, err
+		}
+		after = &u
+	}
+
+	m.mu.RLock()
+	list := []User{}
+	for _, u := range m.users {
+		if !q.Filter.match(u) {
+			continue
+		}
+		if after != nil && compareUsers(u, *after, q.Sort) <= 0 {
+			continue
+		}
+		list = append(list, u)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return compareUsers(list[i], list[j], q.Sort) < 0
+	})
+	if len(list) > q.Limit {
+		return list[:q.Limit], true, nil
+	}
+	return list, false, nil
+}
+
+func (m *memoryUserStore) Get(ctx context.Context, id string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m *memoryUserStore) Create(ctx context.Context, u User) (User, error) {
+	id, err := newUserID()
+	if err != nil {
+		return User{}, err
+	}
+	u.ID = id
+	u.Version = 1
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[u.ID] = u
+	return u, nil
+}
+
+func (m *memoryUserStore) Update(ctx context.Context, u User) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if err := checkVersion(stored.Version, u.Version); err != nil {
+		return User{}, err
+	}
+	u.Version = stored.Version + 1
+	m.users[u.ID] = u
+	return u, nil
+}
+
+func (m *memoryUserStore) Delete(ctx context.Context, id string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if err := checkVersion(stored.Version, version); err != nil {
+		return err
+	}
+	delete(m.users, id)
+	return nil
+}
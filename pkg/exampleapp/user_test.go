@@ -0,0 +1,195 @@
+package exampleapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jusongchen/REST-app/pkg/rest/idempotency"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+	"github.com/stretchr/testify/require"
+)
+
+func newUserTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	c := restful.NewContainer()
+	c.Add(NewUserResource(NewMemoryUserStore(), idempotency.NewMemoryStore()).WebService())
+	ts := httptest.NewServer(c)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doJSON(t *testing.T, method, url string, header map[string]string, body string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if body != "" {
+		req.Header.Set("Content-Type", restful.MIME_JSON)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestUserResource_CRUD(t *testing.T) {
+	ts := newUserTestServer(t)
+	base := ts.URL + userResourceRootPath
+
+	resp, body := doJSON(t, http.MethodPost, base+"/", nil, `{"id":"ignored","name":"john","age":21}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+	var created User
+	require.NoError(t, json.Unmarshal(body, &created))
+	require.NotEqual(t, "ignored", created.ID)
+	require.Equal(t, userResourceRootPath+"/"+created.ID, resp.Header.Get("Location"))
+	require.Equal(t, `"1"`, resp.Header.Get("ETag"))
+	userURL := base + "/" + created.ID
+
+	resp, _ = doJSON(t, http.MethodPost, base+"/", nil, `{"age":21}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = doJSON(t, http.MethodGet, userURL, nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, fmt.Sprintf(`{"id":%q,"name":"john","age":21}`, created.ID), string(body))
+	etag := resp.Header.Get("ETag")
+
+	resp, _ = doJSON(t, http.MethodGet, userURL, map[string]string{"If-None-Match": etag}, "")
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = doJSON(t, http.MethodPut, userURL, nil, `{"name":"jane","age":30}`)
+	require.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, body = doJSON(t, http.MethodPut, userURL, map[string]string{"If-Match": etag}, `{"name":"jane","age":30}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	require.JSONEq(t, fmt.Sprintf(`{"id":%q,"name":"jane","age":30}`, created.ID), string(body))
+	require.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+	// A second writer still holding the first ETag loses.
+	resp, _ = doJSON(t, http.MethodPut, userURL, map[string]string{"If-Match": etag}, `{"name":"joe","age":40}`)
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = doJSON(t, http.MethodGet, userURL, map[string]string{"If-None-Match": etag}, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag = resp.Header.Get("ETag")
+
+	resp, _ = doJSON(t, http.MethodPut, userURL, map[string]string{"If-Match": etag}, `{"id":"other","name":"jane","age":30}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doJSON(t, http.MethodPut, base+"/does-not-exist", map[string]string{"If-Match": "*"}, `{"name":"jane","age":30}`)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	mergePatch := map[string]string{"Content-Type": resource.MIMEMergePatch, "If-Match": etag}
+	resp, body = doJSON(t, http.MethodPatch, userURL, mergePatch, `{"age":31}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	require.JSONEq(t, fmt.Sprintf(`{"id":%q,"name":"jane","age":31}`, created.ID), string(body))
+	require.Equal(t, `"3"`, resp.Header.Get("ETag"))
+
+	resp, _ = doJSON(t, http.MethodPatch, userURL, mergePatch, `{"age":32}`)
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	mergePatch["If-Match"] = "*"
+	resp, _ = doJSON(t, http.MethodPatch, userURL, mergePatch, `{"id":"other"}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doJSON(t, http.MethodDelete, userURL, map[string]string{"If-Match": `W/"3"`}, "")
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	// Any entity tag of a list matches.
+	resp, _ = doJSON(t, http.MethodDelete, userURL, map[string]string{"If-Match": `"1", "2"`}, "")
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp, _ = doJSON(t, http.MethodDelete, userURL, map[string]string{"If-Match": `"2", "3"`}, "")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = doJSON(t, http.MethodGet, userURL, nil, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doJSON(t, http.MethodDelete, userURL, map[string]string{"If-Match": "*"}, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestUserResource_List(t *testing.T) {
+	ts := newUserTestServer(t)
+	base := ts.URL + userResourceRootPath
+
+	for i, name := range []string{"amy", "bob", "cat", "dan", "eve"} {
+		resp, body := doJSON(t, http.MethodPost, base+"/", nil, fmt.Sprintf(`{"name":%q,"age":%d}`, name, 20+i))
+		require.Equal(t, http.StatusCreated, resp.StatusCode, string(body))
+	}
+
+	// Walk all pages following the next links.
+	var names []string
+	next := userResourceRootPath + "/?sort=-age&limit=2"
+	for pages := 0; next != ""; pages++ {
+		require.Less(t, pages, 5)
+		resp, body := doJSON(t, http.MethodGet, ts.URL+next, nil, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+		var list []User
+		require.NoError(t, json.Unmarshal(body, &list))
+		for _, u := range list {
+			names = append(names, u.Name)
+		}
+		next = nextLink(resp.Header.Get("Link"))
+	}
+	require.Equal(t, []string{"eve", "dan", "cat", "bob", "amy"}, names)
+
+	resp, body := doJSON(t, http.MethodGet, base+"/?min_age=21&max_age=23&sort=name", nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list []User
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list, 3)
+	require.Equal(t, "bob", list[0].Name)
+
+	resp, body = doJSON(t, http.MethodGet, base+"/?name=CAT", nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list, 1)
+
+	for _, q := range []string{"sort=email", "min_age=old", "limit=0", "cursor=bogus"} {
+		resp, _ := doJSON(t, http.MethodGet, base+"/?"+q, nil, "")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, q)
+	}
+}
+
+// nextLink extracts the rel="next" target from a Link header.
+func nextLink(header string) string {
+	for _, l := range strings.Split(header, ", ") {
+		if strings.HasSuffix(l, `rel="next"`) {
+			return strings.TrimSuffix(strings.TrimPrefix(strings.SplitN(l, ";", 2)[0], "<"), ">")
+		}
+	}
+	return ""
+}
+
+func TestUserResource_IdempotentCreate(t *testing.T) {
+	ts := newUserTestServer(t)
+	base := ts.URL + userResourceRootPath
+
+	key := map[string]string{idempotency.KeyHeader: "create-john"}
+	resp, first := doJSON(t, http.MethodPost, base+"/", key, `{"name":"john","age":21}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, again := doJSON(t, http.MethodPost, base+"/", key, `{"name":"john","age":21}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(idempotency.ReplayedHeader))
+	require.Equal(t, string(first), string(again))
+
+	resp, _ = doJSON(t, http.MethodPost, base+"/", key, `{"name":"jane","age":21}`)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp, body := doJSON(t, http.MethodGet, base+"/", nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list []User
+	require.NoError(t, json.Unmarshal(body, &list))
+	require.Len(t, list, 1)
+}
@@ -37,35 +37,31 @@ var (
 	// include upon calling DefaultLogger.
 	defaultLogger     *zap.SugaredLogger
 	defaultLoggerOnce sync.Once
-	defaultLevel      = zap.InfoLevel
+	// defaultLevel is shared by all non-debug loggers, so that changing it
+	// applies to the loggers already created.
+	defaultLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
 )
 
-// SetDefaultLevel sets the default log level at which new loggers are created
+// SetDefaultLevel sets the log level of the loggers which are not in debug
+// mode, including the ones already created. Level names are case-insensitive.
 func SetDefaultLevel(level string) error {
-	switch level {
-	case "DEBUG":
-		defaultLevel = zap.DebugLevel
-	case "INFO":
-		defaultLevel = zap.InfoLevel
-	case "WARN":
-		defaultLevel = zap.WarnLevel
-	case "ERROR":
-		defaultLevel = zap.ErrorLevel
-	default:
-		return fmt.Errorf("Unrecognized log level specified: %v" + level)
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unrecognized log level specified: %v", level)
 	}
+	defaultLevel.SetLevel(l)
 	return nil
 }
 
 // GetDefaultLogLevel returns the currently set default log level
 func GetDefaultLogLevel() zapcore.Level {
-	return defaultLevel
+	return defaultLevel.Level()
 }
 
 // NewLogger creates a new logger with the given configuration.
 func NewLogger(debug bool, output ...string) *zap.SugaredLogger {
 	config := &zap.Config{
-		Level:            zap.NewAtomicLevelAt(defaultLevel),
+		Level:            defaultLevel,
 		Development:      false,
 		Sampling:         samplingConfig,
 		Encoding:         encodingJSON,
@@ -156,6 +156,16 @@ func TestSetLogLevel(t *testing.T) {
 	errorLogger.Error("error")
 	require.Containsf(t, sink.String(), `"message":"error"`, "Should log message with contents 'error'")
 	sink.Reset()
+
+	// Loggers created before the level changed follow it
+	defaultLogger.Warn("warn")
+	require.Empty(t, sink.String())
+	logging.SetDefaultLevel("info")
+	defaultLogger.Info("info")
+	require.Containsf(t, sink.String(), `"message":"info"`, "Should log message with contents 'info'")
+	sink.Reset()
+
+	require.Error(t, logging.SetDefaultLevel("verbose"))
 }
 
 func TestDefaultLogger(t *testing.T) {
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jusongchen/REST-app/pkg/logging"
+)
+
+// advisoryLocker implements Locker with Postgres session advisory locks.
+type advisoryLocker struct {
+	db *DB
+}
+
+// NewAdvisoryLocker returns a Locker based on pg_try_advisory_lock. Unlike
+// DB.Lock, it needs no table nor transaction, and a lock is released by the
+// server as soon as the session holding it dies. Each held lock keeps a
+// connection of the pool busy until it is unlocked or times out.
+func NewAdvisoryLocker(db *DB) Locker {
+	return &advisoryLocker{db: db}
+}
+
+// advisoryKey hashes lockID to the key of an advisory lock.
+func advisoryKey(lockID string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(lockID))
+	return int64(h.Sum64())
+}
+
+// Lock acquires lock with given name, which is released after ttl like the
+// locks of DB.Lock. ErrAlreadyLocked will be returned if there is already a lock in use.
+func (l *advisoryLocker) Lock(ctx context.Context, lockID string, ttl time.Duration) (UnlockFn, error) {
+	if _, err := lockSeconds(ttl); err != nil {
+		return nil, err
+	}
+	conn, err := l.db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring connection for lock %q: %w", lockID, err)
+	}
+
+	key := advisoryKey(lockID)
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("locking %q: %w", lockID, err)
+	}
+	if !locked {
+		conn.Release()
+		return nil, ErrAlreadyLocked
+	}
+	logging.FromContext(ctx).Debugf("Acquired advisory lock %q", lockID)
+
+	a := &advisoryLock{lockID: lockID, key: key, conn: conn, ctx: detachedContext{ctx}}
+	a.timer = time.AfterFunc(ttl, func() {
+		if a.release() {
+			logging.FromContext(a.ctx).Warnf("Advisory lock %q expired", lockID)
+		}
+	})
+	return a.unlock, nil
+}
+
+// advisoryLock is a held advisory lock and the connection holding it.
+type advisoryLock struct {
+	lockID string
+	key    int64
+	ctx    context.Context
+	timer  *time.Timer
+
+	mu   sync.Mutex
+	conn *pgxpool.Conn
+	err  error
+}
+
+// release unlocks the lock and returns its connection to the pool. It reports
+// whether the lock was still held.
+func (a *advisoryLock) release() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil {
+		return false
+	}
+
+	var unlocked bool
+	err := a.conn.QueryRow(a.ctx, `SELECT pg_advisory_unlock($1)`, a.key).Scan(&unlocked)
+	if err == nil && !unlocked {
+		err = errors.New("session does not hold the lock")
+	}
+	if err != nil {
+		// Closing the session is the other way to release its locks.
+		a.conn.Conn().Close(a.ctx)
+		a.err = fmt.Errorf("unlocking %q: %w", a.lockID, err)
+	}
+	a.conn.Release()
+	a.conn = nil
+	return true
+}
+
+func (a *advisoryLock) unlock() error {
+	a.timer.Stop()
+	if !a.release() {
+		return fmt.Errorf("cannot release lock %q that no longer belongs to you; it expired: %w", a.lockID, ErrLockLost)
+	}
+	if a.err != nil {
+		return a.err
+	}
+	logging.FromContext(a.ctx).Debugf("Released advisory lock %q", a.lockID)
+	return nil
+}
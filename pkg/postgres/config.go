@@ -1,39 +1,130 @@
 package postgres
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/jusongchen/REST-app/pkg/config"
 )
 
-//Config is a struct to keep db configuration data
+// Config is a struct to keep db configuration data
 type Config struct {
-	Name               string        `env:"DB_NAME" json:",omitempty"`
+	Name               string        `env:"DB_NAME" json:",omitempty" info:"true"`
 	User               string        `env:"DB_USER" json:",omitempty"`
 	Host               string        `env:"DB_HOST, default=localhost" json:",omitempty"`
-	Port               string        `env:"DB_PORT, default=5432" json:",omitempty"`
-	SSLMode            string        `env:"DB_SSLMODE, default=require" json:",omitempty"`
-	ConnectionTimeout  int           `env:"DB_CONNECT_TIMEOUT" json:",omitempty"`
-	Password           string        `env:"DB_PASSWORD" json:"-"` // ignored by zap's JSON formatter
+	Port               string        `env:"DB_PORT, default=5432" json:",omitempty" info:"true"`
+	SSLMode            string        `env:"DB_SSLMODE, default=require" json:",omitempty" info:"true"`
+	ConnectionTimeout  int           `env:"DB_CONNECT_TIMEOUT" json:",omitempty" info:"true"`
+	Password           string        `env:"DB_PASSWORD" json:"-" secret:"true"` // ignored by zap's JSON formatter
 	SSLCertPath        string        `env:"DB_SSLCERT" json:",omitempty"`
 	SSLKeyPath         string        `env:"DB_SSLKEY" json:",omitempty"`
 	SSLRootCertPath    string        `env:"DB_SSLROOTCERT" json:",omitempty"`
-	PoolMinConnections string        `env:"DB_POOL_MIN_CONNS" json:",omitempty"`
-	PoolMaxConnections string        `env:"DB_POOL_MAX_CONNS" json:",omitempty"`
-	PoolMaxConnLife    time.Duration `env:"DB_POOL_MAX_CONN_LIFETIME, default=5m" json:",omitempty"`
-	PoolMaxConnIdle    time.Duration `env:"DB_POOL_MAX_CONN_IDLE_TIME, default=1m" json:",omitempty"`
-	PoolHealthCheck    time.Duration `env:"DB_POOL_HEALTH_CHECK_PERIOD, default=1m" json:",omitempty"`
+	PoolMinConnections string        `env:"DB_POOL_MIN_CONNS" json:",omitempty" info:"true"`
+	PoolMaxConnections string        `env:"DB_POOL_MAX_CONNS" json:",omitempty" info:"true"`
+	PoolMaxConnLife    time.Duration `env:"DB_POOL_MAX_CONN_LIFETIME, default=5m" json:",omitempty" info:"true"`
+	PoolMaxConnIdle    time.Duration `env:"DB_POOL_MAX_CONN_IDLE_TIME, default=1m" json:",omitempty" info:"true"`
+	PoolHealthCheck    time.Duration `env:"DB_POOL_HEALTH_CHECK_PERIOD, default=1m" json:",omitempty" info:"true"`
+
+	// PasswordFile holds the password, read again for every new connection.
+	PasswordFile string `env:"DB_PASSWORD_FILE" json:",omitempty"`
+	// PasswordProvider, if set, supplies the password of every new connection
+	// instead of Password and PasswordFile.
+	PasswordProvider PasswordProvider `json:"-"`
+
+	// SlowQueryThreshold logs the statements running longer, zero disables it.
+	SlowQueryThreshold time.Duration `env:"DB_SLOW_QUERY_THRESHOLD, default=500ms" json:",omitempty" info:"true"`
+
+	// TxMaxRetries is how many times DB.InTx retries a transaction which
+	// failed with a serialization failure or a deadlock, waiting about
+	// TxRetryBackoff, then twice as long, and so on.
+	TxMaxRetries   int           `env:"DB_TX_MAX_RETRIES, default=5" json:",omitempty" info:"true"`
+	TxRetryBackoff time.Duration `env:"DB_TX_RETRY_BACKOFF, default=10ms" json:",omitempty" info:"true"`
+
+	// ReplicaHosts are the read replicas, as host or host:port, serving DB.Reader.
+	ReplicaHosts         []string      `env:"DB_REPLICA_HOSTS" json:",omitempty"`
+	ReplicaMaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG, default=10s" json:",omitempty" info:"true"`
+	ReplicaCheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL, default=5s" json:",omitempty" info:"true"`
 }
 
-//DatabaseConfig returns database Config
+// DatabaseConfig returns database Config
 func (c *Config) DatabaseConfig() *Config {
 	return c
 }
 
-//ConnectionURL returns connection URL
-func (c *Config) ConnectionURL() string {
+// sslModes are the values of sslmode pgx understands.
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate checks the settings of c.
+func (c *Config) Validate() error {
+	var errs config.Errors
+	if c.Name == "" {
+		errs.Add(errors.New("DB_NAME is required"))
+	}
+	if c.Host == "" {
+		errs.Add(errors.New("DB_HOST is required"))
+	}
+	if _, err := strconv.ParseUint(c.Port, 10, 16); c.Port != "" && err != nil {
+		errs.Add(fmt.Errorf("DB_PORT must be a port number, got %q", c.Port))
+	}
+	if c.SSLMode != "" && !contains(sslModes, c.SSLMode) {
+		errs.Add(fmt.Errorf("DB_SSLMODE must be one of %s, got %q", strings.Join(sslModes, ", "), c.SSLMode))
+	}
+	if c.Password != "" && c.PasswordFile != "" {
+		errs.Add(errors.New("DB_PASSWORD and DB_PASSWORD_FILE are exclusive"))
+	}
+	for _, p := range []struct{ name, value string }{
+		{"DB_POOL_MIN_CONNS", c.PoolMinConnections},
+		{"DB_POOL_MAX_CONNS", c.PoolMaxConnections},
+	} {
+		if _, err := strconv.ParseUint(p.value, 10, 31); p.value != "" && err != nil {
+			errs.Add(fmt.Errorf("%s must be a number of connections, got %q", p.name, p.value))
+		}
+	}
+	if c.TxMaxRetries < 0 {
+		errs.Add(fmt.Errorf("DB_TX_MAX_RETRIES must not be negative, got %d", c.TxMaxRetries))
+	}
+	if len(c.ReplicaHosts) > 0 && c.ReplicaMaxLag <= 0 {
+		errs.Add(fmt.Errorf("DB_REPLICA_MAX_LAG must be positive, got %v", c.ReplicaMaxLag))
+	}
+	return errs.Err()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaConfig returns the config of the replica at hostport, which defaults
+// to the port of c.
+func (c *Config) replicaConfig(hostport string) *Config {
+	rc := *c
+	rc.ReplicaHosts = nil
+	rc.Host = hostport
+	if host, port, err := net.SplitHostPort(hostport); err == nil {
+		rc.Host, rc.Port = host, port
+	}
+	return &rc
+}
+
+// passwordTimeout bounds how long ConnectionURL waits for the password when
+// the connection timeout is not set.
+const passwordTimeout = 30 * time.Second
+
+// ConnectionURL returns connection URL, with the current password. Getting the password
+// is bounded by ctx and by the connection timeout, or passwordTimeout if it is not set
+func (c *Config) ConnectionURL(ctx context.Context) (string, error) {
 	if c == nil {
-		return ""
+		return "", nil
 	}
 
 	host := c.Host
@@ -41,9 +132,20 @@ func (c *Config) ConnectionURL() string {
 		host = host + ":" + v
 	}
 
+	timeout := passwordTimeout
+	if c.ConnectionTimeout > 0 {
+		timeout = time.Duration(c.ConnectionTimeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	password, err := c.password(ctx)
+	if err != nil {
+		return "", err
+	}
+
 	u := &url.URL{
 		Scheme: "postgres",
-		User:   url.UserPassword(c.User, c.Password),
+		User:   url.UserPassword(c.User, password),
 		Host:   host,
 		Path:   c.Name,
 	}
@@ -66,5 +168,5 @@ func (c *Config) ConnectionURL() string {
 	}
 	u.RawQuery = q.Encode()
 
-	return u.String()
+	return u.String(), nil
 }
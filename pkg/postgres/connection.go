@@ -8,12 +8,19 @@ import (
 
 	"github.com/jackc/pgx/v4/log/zapadapter"
 	"github.com/jackc/pgx/v4/pgxpool"
-	logging "go.uber.org/zap"
+	"github.com/jusongchen/REST-app/pkg/logging"
 )
 
 //DB struct provides postgres DB access
 type DB struct {
+	// Pool connects to the primary. See Reader for queries replicas may serve.
 	Pool *pgxpool.Pool
+
+	replicas *replicaSet
+
+	// txMaxRetries and txRetryBackoff are the retry budget of InTx.
+	txMaxRetries   int
+	txRetryBackoff time.Duration
 }
 
 // NewFromEnv sets up the database connections using the configuration in the
@@ -23,6 +30,28 @@ func NewFromEnv(ctx context.Context, config *Config) (*DB, error) {
 	logger := logging.FromContext(ctx)
 	logger.Infow("creating pgx connection pool", "hostname", config.Host, "port", config.Port, "dbname", config.Name, "user", config.User)
 
+	pool, err := newPool(ctx, config, false)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infow("creating pgx connection pool succeeded")
+
+	db := &DB{Pool: pool, txMaxRetries: config.TxMaxRetries, txRetryBackoff: config.TxRetryBackoff}
+	if len(config.ReplicaHosts) > 0 {
+		db.replicas, err = newReplicaSet(ctx, config)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+	poolMetrics.add(db, config.Name)
+	return db, nil
+}
+
+// newPool connects to the database of config. A lazy pool connects on first
+// use rather than failing if the database is down.
+func newPool(ctx context.Context, config *Config, lazy bool) (*pgxpool.Pool, error) {
+	logger := logging.FromContext(ctx)
 	connStr := dbConnectionString(config)
 
 	poolConfig, err := pgxpool.ParseConfig(connStr)
@@ -32,7 +61,13 @@ func NewFromEnv(ctx context.Context, config *Config) (*DB, error) {
 		return nil, err
 	}
 
-	poolConfig.ConnConfig.Logger = zapadapter.NewLogger(logger.Desugar())
+	poolConfig.ConnConfig.Logger = &queryLogger{
+		next:   zapadapter.NewLogger(logger.Desugar()),
+		slow:   config.SlowQueryThreshold,
+		logger: logger.Named("query"),
+	}
+	poolConfig.LazyConnect = lazy
+	poolConfig.BeforeConnect = beforeConnect(config, logger.Named("credentials"))
 
 	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
@@ -40,15 +75,17 @@ func NewFromEnv(ctx context.Context, config *Config) (*DB, error) {
 		logger.Error(err)
 		return nil, err
 	}
-
-	logger.Infow("creating pgx connection pool succeeded")
-	return &DB{Pool: pool}, nil
+	return pool, nil
 }
 
 // Close releases database connections.
 func (db *DB) Close(ctx context.Context) {
 	logger := logging.FromContext(ctx)
 	logger.Infof("Closing connection pool.")
+	poolMetrics.remove(db)
+	if db.replicas != nil {
+		db.replicas.close()
+	}
 	db.Pool.Close()
 }
 
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+// PasswordProvider returns the password of a new connection, e.g. a
+// short-lived token obtained from the cloud provider. It must return once ctx
+// is done.
+type PasswordProvider func(ctx context.Context) (string, error)
+
+// password returns the password of a new connection: the one of
+// PasswordProvider if set, else the content of PasswordFile if set, else
+// Password. The file is read every time, so that it can rotate.
+func (c *Config) password(ctx context.Context) (string, error) {
+	switch {
+	case c.PasswordProvider != nil:
+		p, err := c.PasswordProvider(ctx)
+		if err != nil {
+			return "", fmt.Errorf("password provider: %w", err)
+		}
+		return p, nil
+	case c.PasswordFile != "":
+		b, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("reading password file: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		return c.Password, nil
+	}
+}
+
+// beforeConnect returns the pgxpool BeforeConnect hook of config: it sets the
+// current password and TLS files of every new connection. Connections open
+// before a rotation keep their credentials until they are recycled, see
+// PoolMaxConnLife.
+func beforeConnect(config *Config, logger *zap.SugaredLogger) func(context.Context, *pgx.ConnConfig) error {
+	tlsFiles := newTLSWatcher(config, logger)
+	return func(ctx context.Context, cc *pgx.ConnConfig) error {
+		p, err := config.password(ctx)
+		if err != nil {
+			return err
+		}
+		cc.Password = p
+		return tlsFiles.apply(cc)
+	}
+}
+
+// tlsWatcher reloads the TLS configuration of connections when the client
+// certificate, its key or the root certificate changes on disk.
+type tlsWatcher struct {
+	config *Config
+	paths  []string
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	mtimes  []time.Time
+	current *pgconn.Config
+}
+
+func newTLSWatcher(config *Config, logger *zap.SugaredLogger) *tlsWatcher {
+	w := &tlsWatcher{config: config, logger: logger}
+	for _, p := range []string{config.SSLCertPath, config.SSLKeyPath, config.SSLRootCertPath} {
+		if p != "" {
+			w.paths = append(w.paths, p)
+		}
+	}
+	w.mtimes = make([]time.Time, len(w.paths))
+	return w
+}
+
+// apply sets the TLS configuration of cc to the one of the files on disk,
+// parsing them again if they changed since the last connection.
+func (w *tlsWatcher) apply(cc *pgx.ConnConfig) error {
+	if len(w.paths) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := w.current == nil
+	mtimes := make([]time.Time, len(w.paths))
+	for i, p := range w.paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("checking TLS file: %w", err)
+		}
+		mtimes[i] = fi.ModTime()
+		changed = changed || !mtimes[i].Equal(w.mtimes[i])
+	}
+	if changed {
+		// Parsing the connection string loads the TLS files.
+		parsed, err := pgconn.ParseConfig(dbConnectionString(w.config))
+		if err != nil {
+			return fmt.Errorf("loading TLS files: %w", err)
+		}
+		if w.current != nil {
+			w.logger.Infof("Reloaded TLS files %v", w.paths)
+		}
+		w.current, w.mtimes = parsed, mtimes
+	}
+
+	cc.TLSConfig = w.current.TLSConfig.Clone()
+	for i, fb := range cc.Fallbacks {
+		if i < len(w.current.Fallbacks) {
+			fb.TLSConfig = w.current.Fallbacks[i].TLSConfig.Clone()
+		}
+	}
+	return nil
+}
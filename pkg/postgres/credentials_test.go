@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pgx "github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+)
+
+func TestPassword(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{Password: "static"}
+	if p, err := c.password(ctx); err != nil || p != "static" {
+		t.Fatalf("got %q, %v, wanted the static password", p, err)
+	}
+
+	c.PasswordFile = file
+	if p, err := c.password(ctx); err != nil || p != "from-file" {
+		t.Fatalf("got %q, %v, wanted the password of the file", p, err)
+	}
+	// The file is read again: a rotated password is used by the next connection.
+	if err := os.WriteFile(file, []byte("rotated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cc := &pgx.ConnConfig{}
+	if err := beforeConnect(c, zap.NewNop().Sugar())(ctx, cc); err != nil || cc.Password != "rotated" {
+		t.Fatalf("got %q, %v, wanted the rotated password", cc.Password, err)
+	}
+
+	c.PasswordProvider = func(context.Context) (string, error) { return "token", nil }
+	if p, err := c.password(ctx); err != nil || p != "token" {
+		t.Fatalf("got %q, %v, wanted the token of the provider", p, err)
+	}
+	errExpired := errors.New("expired")
+	c.PasswordProvider = func(context.Context) (string, error) { return "", errExpired }
+	if _, err := c.password(ctx); !errors.Is(err, errExpired) {
+		t.Fatalf("got %v, wanted %v", err, errExpired)
+	}
+}
+
+// writeCert writes a new self-signed certificate and its key to certFile and
+// keyFile, and returns the certificate.
+func writeCert(t *testing.T, certFile, keyFile string, modTime time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return der
+}
+
+func TestConnectionURL_PasswordTimeout(t *testing.T) {
+	c := &Config{Host: "db", Name: "app", User: "app", PasswordProvider: func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.ConnectionURL(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, wanted the provider to give up with the context", err)
+	}
+
+	c.PasswordProvider = func(ctx context.Context) (string, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return "", errors.New("no deadline")
+		}
+		return "token", nil
+	}
+	u, err := c.ConnectionURL(context.Background())
+	if err != nil || u != "postgres://app:token@db/app" {
+		t.Fatalf("got %q, %v, wanted the URL with the password of the provider, bounded by a deadline", u, err)
+	}
+}
+
+func TestTLSWatcher(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	first := writeCert(t, certFile, keyFile, time.Now().Add(-time.Minute))
+
+	w := newTLSWatcher(&Config{Host: "db", SSLMode: "require", SSLCertPath: certFile, SSLKeyPath: keyFile}, zap.NewNop().Sugar())
+	clientCert := func() []byte {
+		cc := &pgx.ConnConfig{}
+		if err := w.apply(cc); err != nil {
+			t.Fatal(err)
+		}
+		if cc.TLSConfig == nil || len(cc.TLSConfig.Certificates) != 1 {
+			t.Fatalf("got TLS config %+v, wanted a client certificate", cc.TLSConfig)
+		}
+		return cc.TLSConfig.Certificates[0].Certificate[0]
+	}
+
+	if !bytes.Equal(clientCert(), first) || !bytes.Equal(clientCert(), first) {
+		t.Fatal("did not load the client certificate")
+	}
+
+	second := writeCert(t, certFile, keyFile, time.Now())
+	if !bytes.Equal(clientCert(), second) {
+		t.Fatal("did not reload the rotated client certificate")
+	}
+
+	// Without TLS files, the parsed TLS configuration is left alone.
+	none := newTLSWatcher(&Config{Host: "db"}, zap.NewNop().Sugar())
+	cc := &pgx.ConnConfig{}
+	if err := none.apply(cc); err != nil || cc.TLSConfig != nil {
+		t.Fatalf("got %+v, %v, wanted no change", cc.TLSConfig, err)
+	}
+}
@@ -3,7 +3,6 @@ package postgres
 import (
 	"context"
 	"errors"
-	"fmt"
 	"time"
 
 	pgx "github.com/jackc/pgx/v4"
@@ -26,27 +25,9 @@ func (db *DB) NullableTime(t time.Time) *time.Time {
 }
 
 // InTx runs the given function f within a transaction with isolation level isoLevel.
-func (db *DB) InTx(ctx context.Context, isoLevel pgx.TxIsoLevel, f func(tx pgx.Tx) error) error {
-	conn, err := db.Pool.Acquire(ctx)
-	if err != nil {
-		return fmt.Errorf("acquiring connection: %v", err)
-	}
-	defer conn.Release()
-
-	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: isoLevel})
-	if err != nil {
-		return fmt.Errorf("starting transaction: %v", err)
-	}
-
-	if err := f(tx); err != nil {
-		if err1 := tx.Rollback(ctx); err1 != nil {
-			return fmt.Errorf("rolling back transaction: %v (original error: %v)", err1, err)
-		}
-		return err
-	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("committing transaction: %v", err)
-	}
-	return nil
+// It always runs on the primary. If the transaction fails with a serialization
+// failure or a deadlock, f runs again in a new transaction after a backoff, up
+// to the retry budget of the DB: f must have no effect outside the transaction.
+func (db *DB) InTx(ctx context.Context, isoLevel pgx.TxIsoLevel, f func(tx pgx.Tx) error, opts ...TxOption) error {
+	return db.inTx(ctx, db.Pool, isoLevel, f, opts)
 }
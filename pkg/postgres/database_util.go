@@ -2,32 +2,20 @@ package postgres
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"net/url"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strconv"
 	"testing"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jusongchen/REST-app/migration"
 	"github.com/ory/dockertest"
 	"github.com/sethvargo/go-retry"
-
-	// imported to register the postgres migration driver
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	// imported to register the "file" source migration driver
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	// imported to register the "postgres" database driver for migrate
-)
-
-const (
-	//this is for testing only
-	dbMigrationScriptLocation = "../../migration"
 )
 
 // NewTestDatabaseWithConfig creates a new database suitable for use in testing.
@@ -123,12 +111,12 @@ func NewTestDatabaseWithConfig(tb testing.TB) (*DB, *Config) {
 	}
 
 	// Run the migrations.
-	if err := dbMigrate(connURL.String(), dbMigrationsDir(dbMigrationScriptLocation)); err != nil {
+	if err := dbMigrate(connURL.String(), migration.FS); err != nil {
 		tb.Fatalf("failed to migrate database: %s", err)
 	}
 
 	// Create the db instance.
-	db := &DB{Pool: dbpool}
+	db := &DB{Pool: dbpool, txMaxRetries: 5, txRetryBackoff: 10 * time.Millisecond}
 
 	// Close db when done.
 	tb.Cleanup(func() {
@@ -155,37 +143,19 @@ func NewTestDatabase(tb testing.TB) *DB {
 
 //DbMigrate runs DB migration scripts
 func DbMigrate(dbConnURL, scriptDir string) error {
-	return dbMigrate(dbConnURL, scriptDir)
+	return dbMigrate(dbConnURL, os.DirFS(scriptDir))
 }
 
 // dbMigrate runs the migrations. u is the connection URL string (e.g.
 // postgres://...).
-func dbMigrate(u string, scriptDir string) error {
-	// Run the migrations
-	migrationsDir := fmt.Sprintf("file://%s", scriptDir)
-	m, err := migrate.New(migrationsDir, u)
+func dbMigrate(u string, fsys fs.FS) error {
+	m, err := NewMigrator(u, fsys)
 	if err != nil {
-		return fmt.Errorf("failed create migrate: %w", err)
+		return err
 	}
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	if err := m.Up(); err != nil {
+		m.Close()
 		return fmt.Errorf("failed run migrate: %w", err)
 	}
-	srcErr, dbErr := m.Close()
-	if srcErr != nil {
-		return fmt.Errorf("migrate source error: %w", srcErr)
-	}
-	if dbErr != nil {
-		return fmt.Errorf("migrate database error: %w", dbErr)
-	}
-	return nil
-}
-
-// dbMigrationsDir returns the path on disk to the migrations. It uses
-// runtime.Caller() to get the path to the caller
-func dbMigrationsDir(dir string) string {
-	_, filename, _, ok := runtime.Caller(1)
-	if !ok {
-		return ""
-	}
-	return filepath.Join(filepath.Dir(filename), dir)
+	return m.Close()
 }
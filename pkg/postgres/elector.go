@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var isLeaderGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "leader_election_is_leader",
+	Help: "1 if this process leads the election, 0 otherwise.",
+}, []string{"election"})
+
+// ElectorConfig configures an Elector.
+type ElectorConfig struct {
+	// Election names the election: it is the ID of the lock the candidates
+	// compete for.
+	Election string
+	// Identity names the candidate. It defaults to the host name and process ID.
+	Identity string
+	// LeaseDuration is how long leadership lasts without renewal, hence how
+	// long the other candidates wait before taking over from a dead leader.
+	// It defaults to 15s and is truncated to seconds.
+	LeaseDuration time.Duration
+	// RenewInterval is how often the leader renews its lease. It defaults to
+	// a third of LeaseDuration.
+	RenewInterval time.Duration
+	// RetryInterval is how often a follower tries to become the leader. It
+	// defaults to RenewInterval.
+	RetryInterval time.Duration
+
+	// OnStartedLeading runs in its own goroutine when the candidate becomes
+	// the leader. ctx is cancelled when it stops leading; the lease is given
+	// up only once OnStartedLeading returned.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called after the candidate stopped leading.
+	OnStoppedLeading func()
+	// OnNewLeader is called when the observed leader changes. identity is
+	// empty while the leader is unknown.
+	OnNewLeader func(identity string)
+}
+
+// ElectionStatus is what a candidate knows about an election.
+type ElectionStatus struct {
+	Election string `json:"election"`
+	Identity string `json:"identity"`
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"is_leader"`
+}
+
+// Elector takes part in a leader election through the Lock table, so that
+// singleton jobs run on exactly one of several replicas. The leader holds
+// the lock named after the election and renews it; when it stops renewing,
+// the lock expires and another candidate takes over.
+type Elector struct {
+	db     *DB
+	conf   ElectorConfig
+	logger *zap.SugaredLogger
+
+	mu       sync.Mutex
+	leader   string
+	isLeader bool
+	stop     context.CancelFunc
+	done     chan struct{}
+}
+
+// NewElector returns a stopped Elector for the election in conf.
+func (db *DB) NewElector(conf ElectorConfig) (*Elector, error) {
+	if conf.Election == "" {
+		return nil, errors.New("election name is required")
+	}
+	if conf.Identity == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("os.Hostname: %w", err)
+		}
+		conf.Identity = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if conf.LeaseDuration == 0 {
+		conf.LeaseDuration = 15 * time.Second
+	}
+	if conf.LeaseDuration < time.Second {
+		return nil, fmt.Errorf("lease duration %v is shorter than a second", conf.LeaseDuration)
+	}
+	if conf.RenewInterval == 0 {
+		conf.RenewInterval = conf.LeaseDuration / 3
+	}
+	if conf.RenewInterval >= conf.LeaseDuration {
+		return nil, fmt.Errorf("renew interval %v must be shorter than the lease duration %v", conf.RenewInterval, conf.LeaseDuration)
+	}
+	if conf.RetryInterval == 0 {
+		conf.RetryInterval = conf.RenewInterval
+	}
+
+	isLeaderGauge.WithLabelValues(conf.Election).Set(0)
+	return &Elector{
+		db:     db,
+		conf:   conf,
+		logger: logging.DefaultLogger().Named("Elector").With("election", conf.Election, "identity", conf.Identity),
+	}, nil
+}
+
+// Start campaigns for leadership in the background until Stop is called.
+func (e *Elector) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		return errors.New("elector already started")
+	}
+	var ctx context.Context
+	ctx, e.stop = context.WithCancel(context.Background())
+	e.done = make(chan struct{})
+	go e.run(ctx)
+	return nil
+}
+
+// Stop stops campaigning. A leader cancels OnStartedLeading, waits for it to
+// return and releases the lease, so another candidate can take over at once.
+func (e *Elector) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	stop, done := e.stop, e.done
+	e.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	stop()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stopping elector of %q: %w", e.conf.Election, ctx.Err())
+	}
+}
+
+// Identity returns the name of the candidate.
+func (e *Elector) Identity() string {
+	return e.conf.Identity
+}
+
+// IsLeader reports whether the candidate currently leads the election.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader
+}
+
+// Leader returns the identity of the last observed leader, empty if unknown.
+func (e *Elector) Leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Status returns what the candidate knows about the election.
+func (e *Elector) Status() ElectionStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return ElectionStatus{
+		Election: e.conf.Election,
+		Identity: e.conf.Identity,
+		Leader:   e.leader,
+		IsLeader: e.isLeader,
+	}
+}
+
+func (e *Elector) setLeader(leader string, isLeader bool) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader, e.isLeader = leader, isLeader
+	e.mu.Unlock()
+
+	if isLeader {
+		isLeaderGauge.WithLabelValues(e.conf.Election).Set(1)
+	} else {
+		isLeaderGauge.WithLabelValues(e.conf.Election).Set(0)
+	}
+	if changed && e.conf.OnNewLeader != nil {
+		e.conf.OnNewLeader(leader)
+	}
+}
+
+// run campaigns until ctx is done.
+func (e *Elector) run(ctx context.Context) {
+	defer close(e.done)
+	for {
+		lease, err := e.db.TryLock(ctx, e.conf.Election, e.conf.LeaseDuration, WithHolder(e.conf.Identity))
+		switch {
+		case err == nil:
+			e.lead(ctx, lease)
+		case errors.Is(err, ErrAlreadyLocked):
+			e.observe(ctx)
+		case ctx.Err() == nil:
+			e.logger.Errorf("campaign: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.conf.RetryInterval):
+		}
+	}
+}
+
+// observe records the current leader.
+func (e *Elector) observe(ctx context.Context) {
+	leader, _, err := e.db.LockHolder(ctx, e.conf.Election)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		if ctx.Err() == nil {
+			e.logger.Errorf("observe: %v", err)
+		}
+		return
+	}
+	e.setLeader(leader, false)
+}
+
+// lead renews lease until it is lost, cannot be renewed in time or ctx is done.
+func (e *Elector) lead(ctx context.Context, lease *Lease) {
+	e.logger.Infof("started leading with token %d", lease.Token)
+	e.setLeader(e.conf.Identity, true)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if e.conf.OnStartedLeading != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.conf.OnStartedLeading(leadCtx)
+		}()
+	}
+
+	renewed := time.Now()
+	ticker := time.NewTicker(e.conf.RenewInterval)
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		err := lease.Renew(ctx)
+		switch {
+		case err == nil:
+			renewed = time.Now()
+		case errors.Is(err, ErrLockLost):
+			e.logger.Warnf("lost leadership: %v", err)
+			break loop
+		case ctx.Err() != nil:
+			break loop
+		default:
+			e.logger.Errorf("renew: %v", err)
+			// Step down before the lease may expire under us.
+			if time.Since(renewed) >= e.conf.LeaseDuration-e.conf.RenewInterval {
+				e.logger.Warnf("could not renew leadership since %v, stepping down", renewed)
+				break loop
+			}
+		}
+	}
+	ticker.Stop()
+
+	cancel()
+	wg.Wait()
+	if err := lease.Unlock(); err != nil && !errors.Is(err, ErrLockLost) {
+		e.logger.Errorf("release leadership: %v", err)
+	}
+	e.setLeader("", false)
+	e.logger.Infof("stopped leading")
+	if e.conf.OnStoppedLeading != nil {
+		e.conf.OnStoppedLeading()
+	}
+}
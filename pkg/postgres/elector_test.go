@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElector(t *testing.T) {
+	t.Parallel()
+
+	testDB := NewTestDatabase(t)
+	ctx := context.Background()
+
+	leading := make(chan string, 2)
+	stopped := make(chan string, 2)
+	newElector := func(identity string) *Elector {
+		t.Helper()
+		e, err := testDB.NewElector(ElectorConfig{
+			Election:      "test",
+			Identity:      identity,
+			LeaseDuration: 2 * time.Second,
+			RenewInterval: 200 * time.Millisecond,
+			RetryInterval: 50 * time.Millisecond,
+			OnStartedLeading: func(ctx context.Context) {
+				leading <- identity
+				<-ctx.Done()
+			},
+			OnStoppedLeading: func() { stopped <- identity },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	first := newElector("first")
+	select {
+	case got := <-leading:
+		if got != "first" {
+			t.Fatalf("got leader %q, wanted first", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no leader elected")
+	}
+	if !first.IsLeader() {
+		t.Fatal("first is not leader")
+	}
+
+	second := newElector("second")
+	defer second.Stop(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for second.Leader() != "first" {
+		if time.Now().After(deadline) {
+			t.Fatalf("second observed leader %q, wanted first", second.Leader())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if second.IsLeader() {
+		t.Fatal("both candidates lead")
+	}
+
+	// The leader gives up its lease on Stop, so the other candidate takes
+	// over long before the lease would expire.
+	if err := first.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-stopped; got != "first" {
+		t.Fatalf("got %q stopped leading, wanted first", got)
+	}
+	select {
+	case got := <-leading:
+		if got != "second" {
+			t.Fatalf("got leader %q, wanted second", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second did not take over")
+	}
+	if s := second.Status(); !s.IsLeader || s.Leader != "second" {
+		t.Fatalf("got status %+v, wanted second leading", s)
+	}
+}
+
+func TestNewElector_Config(t *testing.T) {
+	db := &DB{}
+	if _, err := db.NewElector(ElectorConfig{}); err == nil {
+		t.Fatal("elector without election name")
+	}
+	if _, err := db.NewElector(ElectorConfig{Election: "e", LeaseDuration: time.Second, RenewInterval: time.Second}); err == nil {
+		t.Fatal("elector renewing no faster than its lease expires")
+	}
+	e, err := db.NewElector(ElectorConfig{Election: "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Identity() == "" || e.conf.RenewInterval != 5*time.Second {
+		t.Fatalf("got config %+v, wanted defaults", e.conf)
+	}
+}
@@ -1,5 +1,17 @@
 package postgres
 
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+)
+
 // Error is a custom error type for errors returned by envconfig.
 type Error string
 
@@ -12,3 +24,135 @@ const (
 	//ErrConnPoolFail return this error when creating connection pool failed
 	ErrConnPoolFail = Error("creating pgx connection pool failed")
 )
+
+// Classes of database errors, see Classify.
+var (
+	// ErrForeignKeyViolation indicates that a row references a missing row.
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+
+	// ErrCheckViolation indicates that a row fails a check constraint.
+	ErrCheckViolation = errors.New("check violation")
+
+	// ErrSerializationFailure indicates that a transaction failed to serialize
+	// with a concurrent one, or deadlocked with it. Retrying it may succeed.
+	ErrSerializationFailure = errors.New("serialization failure")
+
+	// ErrQueryCanceled indicates that a statement was canceled, e.g. because
+	// it exceeded the statement timeout or the deadline of its context.
+	ErrQueryCanceled = errors.New("query canceled")
+
+	// ErrConnectionLost indicates that the connection to the database broke or
+	// the server is shutting down.
+	ErrConnectionLost = errors.New("database connection lost")
+)
+
+// DBError is a driver error classified by Classify. errors.Is matches its
+// class, e.g. ErrKeyConflict, and errors.As still finds the driver error,
+// e.g. *pgconn.PgError.
+type DBError struct {
+	// Class is one of ErrNotFound, ErrKeyConflict, ErrForeignKeyViolation,
+	// ErrCheckViolation, ErrSerializationFailure, ErrQueryCanceled or
+	// ErrConnectionLost.
+	Class error
+	// Code is the SQLSTATE of the error, empty if the server did not report it.
+	Code string
+	// Table and Constraint name what a constraint violation violated.
+	Table      string
+	Constraint string
+
+	Err error
+}
+
+func (e *DBError) Error() string {
+	if e.Constraint != "" {
+		return e.Class.Error() + " on constraint " + e.Constraint + ": " + e.Err.Error()
+	}
+	return e.Class.Error() + ": " + e.Err.Error()
+}
+
+// Is reports whether target is the class of e.
+func (e *DBError) Is(target error) bool {
+	return target == e.Class
+}
+
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// Classify wraps err, as returned by pgx, into a *DBError if it belongs to one
+// of the classes of DBError. Other errors, and errors already classified, are
+// returned unchanged.
+func Classify(err error) error {
+	var dbErr *DBError
+	if err == nil || errors.As(err, &dbErr) {
+		return err
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &DBError{Class: ErrNotFound, Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		class := pgClass(pgErr.Code)
+		if class == nil {
+			return err
+		}
+		return &DBError{Class: class, Code: pgErr.Code, Table: pgErr.TableName, Constraint: pgErr.ConstraintName, Err: err}
+	}
+
+	// Context errors implement net.Error too: a deadline is a canceled
+	// statement, a canceled context is the caller giving up, not a failure.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &DBError{Class: ErrQueryCanceled, Err: err}
+	}
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &DBError{Class: ErrConnectionLost, Err: err}
+	}
+	return err
+}
+
+// HTTPStatus returns the HTTP status of an error classified by Classify, and
+// false if err is of no known class: a failed constraint is a conflict, a
+// transient failure leaves the service unavailable.
+func HTTPStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, ErrKeyConflict),
+		errors.Is(err, ErrForeignKeyViolation),
+		errors.Is(err, ErrCheckViolation):
+		return http.StatusConflict, true
+	case errors.Is(err, ErrSerializationFailure),
+		errors.Is(err, ErrQueryCanceled),
+		errors.Is(err, ErrConnectionLost):
+		return http.StatusServiceUnavailable, true
+	}
+	return 0, false
+}
+
+// pgClass returns the class of SQLSTATE code, nil if it has none.
+func pgClass(code string) error {
+	switch code {
+	case "23505": // unique_violation
+		return ErrKeyConflict
+	case "23503": // foreign_key_violation
+		return ErrForeignKeyViolation
+	case "23514": // check_violation
+		return ErrCheckViolation
+	case serializationFailure, deadlockDetected:
+		return ErrSerializationFailure
+	case "57014": // query_canceled
+		return ErrQueryCanceled
+	case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		return ErrConnectionLost
+	}
+	if strings.HasPrefix(code, "08") { // connection_exception
+		return ErrConnectionLost
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+func TestClassify(t *testing.T) {
+	errOther := errors.New("other")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no rows", pgx.ErrNoRows, ErrNotFound},
+		{"unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "users_pkey"}, ErrKeyConflict},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, ErrForeignKeyViolation},
+		{"check violation", &pgconn.PgError{Code: "23514"}, ErrCheckViolation},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, ErrSerializationFailure},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, ErrSerializationFailure},
+		{"statement timeout", &pgconn.PgError{Code: "57014"}, ErrQueryCanceled},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, ErrConnectionLost},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, ErrConnectionLost},
+		{"unexpected EOF", fmt.Errorf("reading: %w", io.ErrUnexpectedEOF), ErrConnectionLost},
+		{"context deadline", fmt.Errorf("timeout: %w", context.DeadlineExceeded), ErrQueryCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("doing: %w", Classify(tt.err))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, wanted %v", err, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, which no longer wraps %v", err, tt.err)
+			}
+		})
+	}
+
+	// Unknown errors are left alone.
+	for _, err := range []error{nil, errOther, &pgconn.PgError{Code: "42601"}, fmt.Errorf("query: %w", context.Canceled)} {
+		if got := Classify(err); got != err {
+			t.Errorf("got %v, wanted %v unchanged", got, err)
+		}
+	}
+
+	// Constraint violations carry the constraint.
+	var dbErr *DBError
+	err := Classify(&pgconn.PgError{Code: "23505", TableName: "users", ConstraintName: "users_pkey", Message: "duplicate key"})
+	if !errors.As(err, &dbErr) || dbErr.Table != "users" || dbErr.Constraint != "users_pkey" || dbErr.Code != "23505" {
+		t.Fatalf("got %#v, wanted the constraint users_pkey of table users", err)
+	}
+	if Classify(err) != err {
+		t.Fatal("classified an error twice")
+	}
+}
+
+func TestClassifyFromDatabase(t *testing.T) {
+	t.Parallel()
+
+	db := NewTestDatabase(t)
+	ctx := context.Background()
+
+	insert := func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO Lock (lock_id, expires) VALUES ('classify', now())`)
+		return err
+	}
+	if err := db.InTx(ctx, pgx.ReadCommitted, insert); err != nil {
+		t.Fatal(err)
+	}
+	err := db.InTx(ctx, pgx.ReadCommitted, insert)
+	var dbErr *DBError
+	if !errors.Is(err, ErrKeyConflict) || !errors.As(err, &dbErr) || dbErr.Table != "lock" || dbErr.Constraint == "" {
+		t.Fatalf("got %v, wanted a key conflict on a constraint of table lock", err)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{Classify(&pgconn.PgError{Code: "23505"}), http.StatusConflict},
+		{Classify(&pgconn.PgError{Code: "23503"}), http.StatusConflict},
+		{Classify(&pgconn.PgError{Code: "40001"}), http.StatusServiceUnavailable},
+		{Classify(&pgconn.PgError{Code: "57014"}), http.StatusServiceUnavailable},
+		{ErrNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		got, ok := HTTPStatus(fmt.Errorf("storing: %w", tt.err))
+		if !ok || got != tt.want {
+			t.Errorf("HTTPStatus(%v) = %d, %v, wanted %d", tt.err, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := HTTPStatus(errors.New("boom")); ok {
+		t.Error("an unclassified error has no status")
+	}
+}
@@ -4,60 +4,319 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	pgx "github.com/jackc/pgx/v4"
-	logging "go.uber.org/zap"
+	"github.com/jusongchen/REST-app/pkg/logging"
+	"github.com/sethvargo/go-retry"
 )
 
 var (
 	// ErrAlreadyLocked is returned if the lock is already in use.
 	ErrAlreadyLocked = errors.New("lock already in use")
 
-	// thePast is a date sufficiently in the past to allow safer comparison to "zero date" from Postgres.
-	thePast = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	// ErrLockLost is returned when renewing or releasing a lock which expired
+	// and was acquired by another process.
+	ErrLockLost = errors.New("lock no longer held")
+)
+
+const (
+	defaultLockMinBackoff = 20 * time.Millisecond
+	defaultLockMaxBackoff = time.Second
 )
 
 // UnlockFn can be deferred to release a lock.
 type UnlockFn func() error
 
+// Locker acquires named locks shared by all processes using the database.
+type Locker interface {
+	// Lock acquires lock with given name that times out after ttl. ErrAlreadyLocked will be returned if there is already a lock in use.
+	Lock(ctx context.Context, lockID string, ttl time.Duration) (UnlockFn, error)
+}
+
+var _ Locker = (*DB)(nil)
+
+// Lease is an acquired lock.
+type Lease struct {
+	// LockID is the name of the lock.
+	LockID string
+
+	// Token is the fencing token of this acquisition. Tokens grow with every
+	// acquisition of any lock, so a resource written under the lock can keep
+	// the highest token it has seen and reject writes carrying a lower one:
+	// they come from a holder whose lock expired in the meantime.
+	Token int64
+
+	db  *DB
+	ctx context.Context
+	ttl time.Duration
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// LockOption customizes how a lock is acquired and held.
+type LockOption func(*lockOptions)
+
+type lockOptions struct {
+	holder     string
+	keepAlive  time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// WithKeepAlive renews the lock every interval until it is unlocked, so it
+// does not expire while its holder is alive. An interval of zero renews the
+// lock three times per TTL.
+func WithKeepAlive(interval time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.keepAlive = interval
+		if interval <= 0 {
+			o.keepAlive = -1
+		}
+	}
+}
+
+// WithHolder records holder as the owner of the lock, see LockHolder. A
+// lock acquired without it has no holder.
+func WithHolder(holder string) LockOption {
+	return func(o *lockOptions) {
+		o.holder = holder
+	}
+}
+
+// WithLockBackoff sets how long LockWait waits between attempts: from min,
+// growing along a Fibonacci sequence, up to max.
+func WithLockBackoff(min, max time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.minBackoff, o.maxBackoff = min, max
+	}
+}
+
 // Lock acquires lock with given name that times out after ttl. Returns an UnlockFn that can be used to unlock the lock. ErrAlreadyLocked will be returned if there is already a lock in use.
 func (db *DB) Lock(ctx context.Context, lockID string, ttl time.Duration) (UnlockFn, error) {
-	var expires time.Time
-	err := db.InTx(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+	l, err := db.TryLock(ctx, lockID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return l.Unlock, nil
+}
+
+// TryLock acquires lock with given name that times out after ttl, unless it is
+// kept alive. ErrAlreadyLocked will be returned if there is already a lock in use.
+// Cancelling ctx after TryLock returns does not stop the keep-alive nor
+// prevent Unlock: the lease outlives the request which acquired it.
+func (db *DB) TryLock(ctx context.Context, lockID string, ttl time.Duration, opts ...LockOption) (*Lease, error) {
+	o := lockOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	seconds, err := lockSeconds(ttl)
+	if err != nil {
+		return nil, err
+	}
+	var token int64
+	err = db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
 		row := tx.QueryRow(ctx, `
-			SELECT AcquireLock($1, $2)
-		`, lockID, int(ttl.Seconds()))
-		if err := row.Scan(&expires); err != nil {
+			SELECT AcquireLockToken($1, $2)
+		`, lockID, seconds)
+		if err := row.Scan(&token); err != nil {
 			return err
 		}
-		if expires.Before(thePast) {
+		if token == 0 {
 			return ErrAlreadyLocked
 		}
-		return nil
+		// Always write the holder, even none: a lock taken over after it
+		// expired would otherwise report the previous one.
+		_, err := tx.Exec(ctx, `
+			UPDATE Lock SET holder = $3 WHERE lock_id = $1 AND token = $2
+		`, lockID, token, o.holder)
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
-	logging.FromContext(ctx).Debugf("Acquired lock %q", lockID)
-	return makeUnlockFn(ctx, db, lockID, expires), nil
+	logging.FromContext(ctx).Debugf("Acquired lock %q with token %d", lockID, token)
+
+	l := &Lease{
+		LockID:  lockID,
+		Token:   token,
+		db:      db,
+		ctx:     detachedContext{ctx},
+		ttl:     ttl,
+		lost:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if o.keepAlive == 0 {
+		close(l.stopped)
+		return l, nil
+	}
+	interval := o.keepAlive
+	if interval < 0 {
+		interval = ttl / 3
+	}
+	go l.keepAlive(interval)
+	return l, nil
 }
 
-func makeUnlockFn(ctx context.Context, db *DB, lockID string, expires time.Time) UnlockFn {
-	return func() error {
-		return db.InTx(ctx, pgx.Serializable, func(tx pgx.Tx) error {
-			row := tx.QueryRow(ctx, `
-				SELECT ReleaseLock($1, $2)
-			`, lockID, expires)
-			var released bool
-			if err := row.Scan(&released); err != nil {
-				return err
-			}
-			if !released {
-				return fmt.Errorf("cannot delete lock %q that no longer belongs to you; it likely expired and was taken by another process", lockID)
-			}
-			logging.FromContext(ctx).Debugf("Released lock %q", lockID)
-			return nil
-		})
+// LockWait acquires lock with given name like TryLock, waiting with backoff
+// while the lock is in use until ctx is done. If the lock is still in use
+// then, the error is both ErrAlreadyLocked and ctx.Err().
+func (db *DB) LockWait(ctx context.Context, lockID string, ttl time.Duration, opts ...LockOption) (*Lease, error) {
+	o := lockOptions{minBackoff: defaultLockMinBackoff, maxBackoff: defaultLockMaxBackoff}
+	for _, opt := range opts {
+		opt(&o)
 	}
+	b, err := retry.NewFibonacci(o.minBackoff)
+	if err != nil {
+		return nil, err
+	}
+	b = retry.WithCappedDuration(o.maxBackoff, b)
+
+	var l *Lease
+	var held bool
+	err = retry.Do(ctx, b, func(ctx context.Context) error {
+		var err error
+		l, err = db.TryLock(ctx, lockID, ttl, opts...)
+		if errors.Is(err, ErrAlreadyLocked) {
+			held = true
+			return retry.RetryableError(err)
+		}
+		if ctx.Err() == nil {
+			// an attempt cut short by ctx keeps what the previous one saw
+			held = false
+		}
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("waiting for lock %q: %w", lockID, err)
+		if held {
+			return nil, heldError{err}
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// heldError is the error of LockWait giving up on a lock still in use: it is
+// ErrAlreadyLocked as well as the reason it gave up, such as ctx being done.
+type heldError struct {
+	error
+}
+
+func (e heldError) Unwrap() error { return e.error }
+
+func (e heldError) Is(target error) bool { return target == ErrAlreadyLocked }
+
+// LockHolder returns the holder recorded by WithHolder and the fencing token
+// of lock lockID. It returns ErrNotFound if the lock is free.
+func (db *DB) LockHolder(ctx context.Context, lockID string) (string, int64, error) {
+	var holder string
+	var token int64
+	row := db.Pool.QueryRow(ctx, `
+		SELECT holder, token FROM Lock WHERE lock_id = $1 AND expires > CURRENT_TIMESTAMP
+	`, lockID)
+	if err := row.Scan(&holder, &token); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", 0, ErrNotFound
+		}
+		return "", 0, fmt.Errorf("reading holder of lock %q: %w", lockID, err)
+	}
+	return holder, token, nil
+}
+
+// Renew extends the lock to expire ttl from now. It returns ErrLockLost if
+// the lock expired and was acquired by another process.
+func (l *Lease) Renew(ctx context.Context) error {
+	seconds, err := lockSeconds(l.ttl)
+	if err != nil {
+		return err
+	}
+	var renewed bool
+	row := l.db.Pool.QueryRow(ctx, `
+		SELECT RenewLock($1, $2, $3)
+	`, l.LockID, l.Token, seconds)
+	if err := row.Scan(&renewed); err != nil {
+		return fmt.Errorf("renewing lock %q: %w", l.LockID, err)
+	}
+	if !renewed {
+		l.lostOnce.Do(func() { close(l.lost) })
+		return fmt.Errorf("renewing lock %q: %w", l.LockID, ErrLockLost)
+	}
+	return nil
+}
+
+// Lost is closed when renewing the lock found it taken by another process.
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
 }
+
+// keepAlive renews the lock every interval until the lease is stopped or lost.
+func (l *Lease) keepAlive(interval time.Duration) {
+	defer close(l.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		err := l.Renew(l.ctx)
+		if errors.Is(err, ErrLockLost) {
+			logging.FromContext(l.ctx).Warnf("Lost lock %q with token %d", l.LockID, l.Token)
+			return
+		}
+		if err != nil {
+			logging.FromContext(l.ctx).Errorf("Keep alive: %v", err)
+		}
+	}
+}
+
+// Unlock stops renewing the lock and releases it.
+func (l *Lease) Unlock() error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.stopped
+
+	return l.db.InTx(l.ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		row := tx.QueryRow(l.ctx, `
+			SELECT ReleaseLockToken($1, $2)
+		`, l.LockID, l.Token)
+		var released bool
+		if err := row.Scan(&released); err != nil {
+			return err
+		}
+		if !released {
+			return fmt.Errorf("cannot delete lock %q that no longer belongs to you; it likely expired and was taken by another process: %w", l.LockID, ErrLockLost)
+		}
+		logging.FromContext(l.ctx).Debugf("Released lock %q", l.LockID)
+		return nil
+	})
+}
+
+// lockSeconds returns ttl in the whole seconds the lock functions take,
+// rounded up so that a lock does not expire before ttl.
+func lockSeconds(ttl time.Duration) (int, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("lock TTL must be positive, got %v", ttl)
+	}
+	return int(math.Ceil(ttl.Seconds())), nil
+}
+
+// detachedContext carries the values of its parent, such as the logger, but
+// is never cancelled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -11,6 +12,25 @@ func TestLock(t *testing.T) {
 	t.Parallel()
 
 	testDB := NewTestDatabase(t)
+	testLocker(t, testDB, func(ctx context.Context) (count int, err error) {
+		err = testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM Lock`).Scan(&count)
+		return
+	})
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	t.Parallel()
+
+	testDB := NewTestDatabase(t)
+	testLocker(t, NewAdvisoryLocker(testDB), func(ctx context.Context) (count int, err error) {
+		err = testDB.Pool.QueryRow(ctx, `SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND database = (SELECT oid FROM pg_database WHERE datname = current_database())`).Scan(&count)
+		return
+	})
+}
+
+// testLocker runs the Locker test cases against locker; held counts the
+// locks held in the database.
+func testLocker(t *testing.T, locker Locker, held func(ctx context.Context) (int, error)) {
 	ctx := context.Background()
 
 	const (
@@ -20,7 +40,7 @@ func TestLock(t *testing.T) {
 
 	mustLock := func(id string, ttl time.Duration) UnlockFn {
 		t.Helper()
-		unlock, err := testDB.Lock(ctx, id, ttl)
+		unlock, err := locker.Lock(ctx, id, ttl)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -31,7 +51,7 @@ func TestLock(t *testing.T) {
 	unlock1 := mustLock(id1, time.Hour)
 
 	// Fail to grab a held lock.
-	if _, err := testDB.Lock(ctx, id1, time.Hour); !errors.Is(err, ErrAlreadyLocked) {
+	if _, err := locker.Lock(ctx, id1, time.Hour); !errors.Is(err, ErrAlreadyLocked) {
 		t.Fatalf("got %v, wanted ErrAlreadyLocked", err)
 	}
 	unlock2 := mustLock(id2, time.Hour)
@@ -55,17 +75,176 @@ func TestLock(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Lock table should be empty.
-	conn, err := testDB.Pool.Acquire(ctx)
+	// No lock should be held.
+	count, err := held(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("got %d locks held, wanted zero", count)
+	}
+}
+
+func TestAdvisoryKey(t *testing.T) {
+	if advisoryKey("a") == advisoryKey("b") {
+		t.Fatal("distinct lock IDs hash to the same key")
+	}
+	if advisoryKey("a") != advisoryKey("a") {
+		t.Fatal("advisory key is not stable")
+	}
+}
+
+func TestHeldError(t *testing.T) {
+	err := error(heldError{fmt.Errorf("waiting for lock %q: %w", "id", context.DeadlineExceeded)})
+	if !errors.Is(err, ErrAlreadyLocked) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, wanted ErrAlreadyLocked and context.DeadlineExceeded", err)
+	}
+}
+
+func TestLockSeconds(t *testing.T) {
+	for ttl, want := range map[time.Duration]int{
+		time.Millisecond:        1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+		time.Minute:             60,
+	} {
+		got, err := lockSeconds(ttl)
+		if err != nil {
+			t.Fatalf("lockSeconds(%v): %v", ttl, err)
+		}
+		if got != want {
+			t.Errorf("lockSeconds(%v) = %d, want %d", ttl, got, want)
+		}
+	}
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		if _, err := lockSeconds(ttl); err == nil {
+			t.Errorf("lockSeconds(%v) succeeded, want an error", ttl)
+		}
+	}
+}
+
+func TestLockFencing(t *testing.T) {
+	t.Parallel()
+
+	testDB := NewTestDatabase(t)
+	ctx := context.Background()
+
+	l1, err := testDB.TryLock(ctx, "fenced", time.Hour)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer conn.Release()
-	var count int
-	if err := conn.QueryRow(ctx, `SELECT count(*) FROM Lock`).Scan(&count); err != nil {
+	if err := l1.Unlock(); err != nil {
 		t.Fatal(err)
 	}
-	if count != 0 {
-		t.Fatalf("got %d rows from Lock table, wanted zero", count)
+	l2, err := testDB.TryLock(ctx, "fenced", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2.Token <= l1.Token {
+		t.Fatalf("got token %d after %d, wanted a greater one", l2.Token, l1.Token)
+	}
+
+	// A stale holder can neither renew nor release the lock.
+	if err := l1.Renew(ctx); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("got %v, wanted ErrLockLost", err)
+	}
+	select {
+	case <-l1.Lost():
+	default:
+		t.Fatal("lease of a stale holder is not marked lost")
+	}
+	if err := l1.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("got %v, wanted ErrLockLost", err)
+	}
+	if err := l2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	t.Parallel()
+
+	testDB := NewTestDatabase(t)
+	ctx := context.Background()
+
+	held, err := testDB.TryLock(ctx, "wait", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Give up when the context is done.
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := testDB.LockWait(shortCtx, "wait", time.Hour); !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrAlreadyLocked) {
+		t.Fatalf("got %v, wanted context.DeadlineExceeded and ErrAlreadyLocked", err)
+	}
+
+	// Get the lock once it is released.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		held.Unlock()
+	}()
+	l, err := testDB.LockWait(ctx, "wait", time.Hour, WithLockBackoff(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	testDB := NewTestDatabase(t)
+	ctx := context.Background()
+
+	// Without the keep-alive, the lock would expire after a second.
+	l, err := testDB.TryLock(ctx, "alive", time.Second, WithKeepAlive(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	if _, err := testDB.TryLock(ctx, "alive", time.Second); !errors.Is(err, ErrAlreadyLocked) {
+		t.Fatalf("got %v, wanted ErrAlreadyLocked", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlock stopped the keep-alive: the lock is free.
+	l, err = testDB.TryLock(ctx, "alive", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockHolder(t *testing.T) {
+	t.Parallel()
+
+	testDB := NewTestDatabase(t)
+	ctx := context.Background()
+
+	if _, err := testDB.TryLock(ctx, "holder", time.Second, WithHolder("first")); err != nil {
+		t.Fatal(err)
+	}
+	if holder, _, err := testDB.LockHolder(ctx, "holder"); err != nil || holder != "first" {
+		t.Fatalf("got %q, %v, wanted first", holder, err)
+	}
+
+	// Take the lock over once it expired, without a holder.
+	time.Sleep(1500 * time.Millisecond)
+	l, err := testDB.TryLock(ctx, "holder", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder, _, err := testDB.LockHolder(ctx, "holder"); err != nil || holder != "" {
+		t.Fatalf("got %q, %v, wanted no holder", holder, err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
 	}
 }
@@ -0,0 +1,294 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	"github.com/jusongchen/REST-app/pkg/logging"
+
+	// imported to register the postgres migration driver
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+)
+
+// migrationLockID serializes the migrations applied on startup by replicas.
+const migrationLockID = "schema_migrations"
+
+// Step is a migration to run.
+type Step struct {
+	Version    uint
+	Identifier string
+	Up         bool
+}
+
+func (s Step) String() string {
+	direction := "down"
+	if s.Up {
+		direction = "up"
+	}
+	return fmt.Sprintf("%-4s %d %s", direction, s.Version, s.Identifier)
+}
+
+// Migrator applies the schema migrations of a source to a database.
+type Migrator struct {
+	src source.Driver
+	m   *migrate.Migrate
+}
+
+// NewMigrator returns a Migrator applying the migrations in fsys, e.g.
+// migration.FS, to the database at connURL (e.g. postgres://...).
+func NewMigrator(connURL string, fsys fs.FS) (*Migrator, error) {
+	src, err := httpfs.New(http.FS(fsys), ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+	m, err := migrate.NewWithSourceInstance("httpfs", src, connURL)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed create migrate: %w", err)
+	}
+	return &Migrator{src: src, m: m}, nil
+}
+
+// Close releases the source and the database connection.
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	if srcErr != nil {
+		return fmt.Errorf("migrate source error: %w", srcErr)
+	}
+	if dbErr != nil {
+		return fmt.Errorf("migrate database error: %w", dbErr)
+	}
+	return nil
+}
+
+// Version returns the version of the database schema, 0 if no migration ran.
+// dirty reports that a migration failed half way; see Force.
+func (m *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up() error {
+	return noChange(m.m.Up())
+}
+
+// Down reverts the last n migrations.
+func (m *Migrator) Down(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid number of migrations to revert: %d", n)
+	}
+	return noChange(m.m.Steps(-n))
+}
+
+// DownAll reverts all migrations.
+func (m *Migrator) DownAll() error {
+	return noChange(m.m.Down())
+}
+
+// Goto migrates up or down to version.
+func (m *Migrator) Goto(version uint) error {
+	return noChange(m.m.Migrate(version))
+}
+
+// Force sets the schema version without running migrations, clearing the
+// dirty flag. It is how to recover once a failed migration was fixed by hand.
+// A version of -1 means no migration ran.
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+func noChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// PlanUp lists the migrations Up would run.
+func (m *Migrator) PlanUp() ([]Step, error) {
+	cur, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return planUp(m.src, cur, func(uint) bool { return false })
+}
+
+// PlanDown lists the migrations Down(n) would run.
+func (m *Migrator) PlanDown(n int) ([]Step, error) {
+	cur, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return planDown(m.src, cur, func(steps int, _ uint) bool { return steps >= n })
+}
+
+// PlanGoto lists the migrations Goto(version) would run.
+func (m *Migrator) PlanGoto(version uint) ([]Step, error) {
+	cur, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	return planGoto(m.src, cur, version)
+}
+
+// current returns the schema version, nil if no migration ran.
+func (m *Migrator) current() (*uint, error) {
+	v, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("database version %d is dirty, fix it and force the version", v)
+	}
+	return &v, nil
+}
+
+// planUp lists the up migrations after version cur until stop returns true.
+func planUp(src source.Driver, cur *uint, stop func(v uint) bool) ([]Step, error) {
+	var v uint
+	var err error
+	if cur == nil {
+		v, err = src.First()
+	} else {
+		v, err = src.Next(*cur)
+	}
+
+	var steps []Step
+	for ; err == nil && !stop(v); v, err = src.Next(v) {
+		r, id, err := src.ReadUp(v)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %d: %w", v, err)
+		}
+		r.Close()
+		steps = append(steps, Step{Version: v, Identifier: id, Up: true})
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// planDown lists the down migrations from version cur until stop, given the
+// number of steps so far and the version to revert next, returns true.
+func planDown(src source.Driver, cur *uint, stop func(steps int, v uint) bool) ([]Step, error) {
+	if cur == nil {
+		return nil, nil
+	}
+
+	var steps []Step
+	for v := *cur; !stop(len(steps), v); {
+		r, id, err := src.ReadDown(v)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %d: %w", v, err)
+		}
+		r.Close()
+		steps = append(steps, Step{Version: v, Identifier: id})
+
+		v, err = src.Prev(v)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+// planGoto lists the migrations from version cur to version target.
+func planGoto(src source.Driver, cur *uint, target uint) ([]Step, error) {
+	r, _, err := src.ReadUp(target)
+	if err != nil {
+		return nil, fmt.Errorf("no migration with version %d: %w", target, err)
+	}
+	r.Close()
+
+	if cur == nil || *cur < target {
+		return planUp(src, cur, func(v uint) bool { return v > target })
+	}
+	return planDown(src, cur, func(_ int, v uint) bool { return v <= target })
+}
+
+// MigrateUp applies all pending migrations in fsys to the database of config.
+// Replicas starting together take turns through an advisory lock.
+func (db *DB) MigrateUp(ctx context.Context, config *Config, fsys fs.FS) error {
+	logger := logging.FromContext(ctx)
+
+	unlock, err := db.lockMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("locking migrations: %w", err)
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			logger.Errorf("unlocking migrations: %v", err)
+		}
+	}()
+
+	connURL, err := config.ConnectionURL(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := NewMigrator(connURL, fsys)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	from, _, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil {
+		return fmt.Errorf("failed run migrate: %w", err)
+	}
+	to, _, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if from != to {
+		logger.Infof("Migrated database schema from version %d to %d", from, to)
+	}
+	return nil
+}
+
+// lockMigrations waits for the session advisory lock guarding migrations.
+// Migrations cannot rely on DB.Lock: they create its table and functions.
+// The lock is released with the session if the process dies.
+func (db *DB) lockMigrations(ctx context.Context) (UnlockFn, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := advisoryKey(migrationLockID)
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return func() error {
+		defer conn.Release()
+		var unlocked bool
+		if err := conn.QueryRow(context.Background(), `SELECT pg_advisory_unlock($1)`, key).Scan(&unlocked); err != nil {
+			// ending the session releases its lock
+			conn.Conn().Close(context.Background())
+			return err
+		}
+		if !unlocked {
+			return fmt.Errorf("migration lock was not held: %w", ErrLockLost)
+		}
+		return nil
+	}, nil
+}
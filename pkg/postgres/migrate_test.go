@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	"github.com/jusongchen/REST-app/migration"
+)
+
+func versions(steps []Step) []uint {
+	var vs []uint
+	for _, s := range steps {
+		vs = append(vs, s.Version)
+	}
+	return vs
+}
+
+func equalVersions(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlan(t *testing.T) {
+	src, err := httpfs.New(http.FS(migration.FS), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// Every migration of the repository can be listed both ways.
+	all, err := planUp(src, nil, func(uint) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) < 7 || all[0].Version != 1 || all[0].Identifier != "initial" || !all[0].Up {
+		t.Fatalf("got %v, wanted all migrations starting with 1 initial", all)
+	}
+	last := all[len(all)-1].Version
+	back, err := planDown(src, &last, func(int, uint) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back) != len(all) || back[len(back)-1].Version != 1 || back[0].Up {
+		t.Fatalf("got %v, wanted all migrations reverted down to 1", back)
+	}
+
+	three, six := uint(3), uint(6)
+	tests := []struct {
+		name string
+		plan func() ([]Step, error)
+		want []uint
+	}{
+		{"up from 3", func() ([]Step, error) {
+			return planUp(src, &three, func(v uint) bool { return v > 5 })
+		}, []uint{4, 5}},
+		{"down 2 from 6", func() ([]Step, error) {
+			return planDown(src, &six, func(n int, _ uint) bool { return n >= 2 })
+		}, []uint{6, 5}},
+		{"down from nothing", func() ([]Step, error) {
+			return planDown(src, nil, func(int, uint) bool { return false })
+		}, nil},
+		{"goto 5 from 3", func() ([]Step, error) { return planGoto(src, &three, 5) }, []uint{4, 5}},
+		{"goto 3 from 6", func() ([]Step, error) { return planGoto(src, &six, 3) }, []uint{6, 5, 4}},
+		{"goto 2 from nothing", func() ([]Step, error) { return planGoto(src, nil, 2) }, []uint{1, 2}},
+		{"goto 3 from 3", func() ([]Step, error) { return planGoto(src, &three, 3) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := tt.plan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(steps); !equalVersions(got, tt.want) {
+				t.Fatalf("got versions %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := planGoto(src, &three, 9999); err == nil {
+		t.Fatal("planned a migration to a missing version")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	t.Parallel()
+
+	db, conf := NewTestDatabaseWithConfig(t)
+	ctx := context.Background()
+
+	connURL, err := conf.ConnectionURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMigrator(connURL, migration.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	latest, dirty, err := m.Version()
+	if err != nil || dirty || latest == 0 {
+		t.Fatalf("got version %d, dirty %v, err %v, wanted a migrated database", latest, dirty, err)
+	}
+	if steps, err := m.PlanUp(); err != nil || len(steps) != 0 {
+		t.Fatalf("got plan %v, err %v, wanted nothing to do", steps, err)
+	}
+
+	if err := m.Down(2); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := m.Version(); v != latest-2 {
+		t.Fatalf("got version %d after reverting 2, wanted %d", v, latest-2)
+	}
+	if steps, err := m.PlanUp(); err != nil || len(steps) != 2 {
+		t.Fatalf("got plan %v, err %v, wanted 2 migrations", steps, err)
+	}
+
+	// MigrateUp takes the migration lock and applies the rest.
+	if err := db.MigrateUp(ctx, conf, migration.FS); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := m.Version(); v != latest {
+		t.Fatalf("got version %d, wanted %d", v, latest)
+	}
+}
+
+func TestMigrateUp_EmptyDatabase(t *testing.T) {
+	t.Parallel()
+
+	db, conf := NewTestDatabaseWithConfig(t)
+	ctx := context.Background()
+
+	if _, err := db.Pool.Exec(ctx, `CREATE DATABASE empty`); err != nil {
+		t.Fatal(err)
+	}
+	emptyConf := *conf
+	emptyConf.Name = "empty"
+	empty, err := NewFromEnv(ctx, &emptyConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close(ctx)
+
+	// No Lock table nor lock function exists yet.
+	if err := empty.MigrateUp(ctx, &emptyConf, migration.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	connURL, err := conf.ConnectionURL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := NewMigrator(connURL, migration.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrated.Close()
+	latest, _, err := migrated.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connURL, err = emptyConf.ConnectionURL(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMigrator(connURL, migration.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if v, dirty, err := m.Version(); err != nil || dirty || v != latest {
+		t.Fatalf("got version %d, dirty %v, err %v, wanted %d", v, dirty, err, latest)
+	}
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jusongchen/REST-app/pkg/reqid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// maxStatementLength truncates normalized statements, which label metrics.
+const maxStatementLength = 200
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Latency of successful statements, by normalized SQL.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"statement"})
+
+// queryLogger is the pgx logger of a pool: it records the latency of every
+// statement, logs the statements slower than slow, then hands the entry on to
+// next.
+type queryLogger struct {
+	next   pgx.Logger
+	slow   time.Duration
+	logger *zap.SugaredLogger
+}
+
+// Log implements pgx.Logger.
+func (l *queryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if d, ok := data["time"].(time.Duration); ok {
+		if sql, ok := data["sql"].(string); ok {
+			stmt := normalizeSQL(sql)
+			queryDuration.WithLabelValues(stmt).Observe(d.Seconds())
+			if l.slow > 0 && d >= l.slow {
+				l.logger.Warnw("slow query", "sql", stmt, "duration", d, "request_id", reqid.FromContext(ctx))
+			}
+		}
+	}
+	l.next.Log(ctx, level, msg, data)
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\$?\b\d+(?:\.\d+)?\b`)
+)
+
+// normalizeSQL collapses the white space of sql and replaces its literals by
+// ?, so that statements differing only by their values are reported alike.
+func normalizeSQL(sql string) string {
+	sql = stringLiteral.ReplaceAllString(sql, "?")
+	sql = numericLiteral.ReplaceAllStringFunc(sql, func(n string) string {
+		if strings.HasPrefix(n, "$") { // a parameter
+			return n
+		}
+		return "?"
+	})
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > maxStatementLength {
+		sql = sql[:maxStatementLength] + "..."
+	}
+	return sql
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jusongchen/REST-app/pkg/reqid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := map[string]string{
+		"SELECT name\n\t\tFROM users WHERE id = $1":                         "SELECT name FROM users WHERE id = $1",
+		"SELECT * FROM t WHERE a = 'it''s' AND b = 42 AND c = 1.5 LIMIT $2": "SELECT * FROM t WHERE a = ? AND b = ? AND c = ? LIMIT $2",
+		"SELECT col1 FROM table2":                                           "SELECT col1 FROM table2",
+		"SELECT " + strings.Repeat("x", 300):                                "SELECT " + strings.Repeat("x", maxStatementLength-len("SELECT ")) + "...",
+	}
+	for sql, want := range tests {
+		if got := normalizeSQL(sql); got != want {
+			t.Errorf("normalizeSQL(%q) = %q, wanted %q", sql, got, want)
+		}
+	}
+}
+
+type recordingLogger struct {
+	msgs []string
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func TestQueryLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	next := &recordingLogger{}
+	l := &queryLogger{next: next, slow: 100 * time.Millisecond, logger: zap.New(core).Sugar()}
+
+	ctx := reqid.NewContext(context.Background(), "req-1")
+	l.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{"sql": "SELECT 1", "time": time.Millisecond})
+	l.Log(ctx, pgx.LogLevelInfo, "Exec", map[string]interface{}{"sql": "UPDATE t SET a = 2", "time": time.Second})
+	l.Log(ctx, pgx.LogLevelInfo, "closed connection", nil)
+
+	if len(next.msgs) != 3 {
+		t.Fatalf("got %v, wanted every entry handed on", next.msgs)
+	}
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, wanted the slow query only", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["sql"] != "UPDATE t SET a = ?" || fields["request_id"] != "req-1" {
+		t.Fatalf("got fields %v, wanted the normalized statement and the request ID", fields)
+	}
+}
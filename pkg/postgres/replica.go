@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jusongchen/REST-app/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var replicaHealthyGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "db_replica_healthy",
+	Help: "1 if the read replica is reachable and lags less than the maximum, 0 otherwise.",
+}, []string{"host"})
+
+var (
+	// errNotReplica is returned checking a replica host which is a primary.
+	errNotReplica = errors.New("host is not in recovery, not a replica")
+	// errNotStreaming is returned checking a replica which has no connection
+	// to its primary: it received nothing more to replay and would serve
+	// stale reads, however small its lag looks.
+	errNotStreaming = errors.New("replica is not receiving WAL from its primary")
+)
+
+// Writer returns the pool of the primary. It is the same as db.Pool.
+func (db *DB) Writer() *pgxpool.Pool {
+	return db.Pool
+}
+
+// Reader returns the pool of a healthy replica, taking turns between them,
+// or the pool of the primary if there is none. Replicas lag behind the
+// primary: read from Writer what the request just wrote.
+func (db *DB) Reader() *pgxpool.Pool {
+	if db.replicas != nil {
+		if pool := db.replicas.pick(); pool != nil {
+			return pool
+		}
+	}
+	return db.Pool
+}
+
+// InReadTx runs the given function f within a read-only transaction with
+// isolation level isoLevel on the pool returned by Reader, like InTx.
+func (db *DB) InReadTx(ctx context.Context, isoLevel pgx.TxIsoLevel, f func(tx pgx.Tx) error, opts ...TxOption) error {
+	return db.inTx(ctx, db.Reader(), isoLevel, f, append([]TxOption{ReadOnly()}, opts...))
+}
+
+type replica struct {
+	host    string
+	pool    *pgxpool.Pool
+	healthy int32
+}
+
+// replicaSet routes reads to the replicas whose last check was successful.
+type replicaSet struct {
+	replicas []*replica
+	next     uint32
+	maxLag   time.Duration
+	interval time.Duration
+	logger   *zap.SugaredLogger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newReplicaSet connects to the replicas of config and checks them every
+// config.ReplicaCheckInterval until closed. A replica which is down does not
+// fail the call, it is left out until it passes a check.
+func newReplicaSet(ctx context.Context, config *Config) (*replicaSet, error) {
+	s := &replicaSet{
+		maxLag:   config.ReplicaMaxLag,
+		interval: config.ReplicaCheckInterval,
+		logger:   logging.FromContext(ctx).Named("replicas"),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if s.interval <= 0 {
+		s.interval = 5 * time.Second
+	}
+	for _, host := range config.ReplicaHosts {
+		pool, err := newPool(ctx, config.replicaConfig(host), true)
+		if err != nil {
+			s.closePools()
+			return nil, fmt.Errorf("replica %s: %w", host, err)
+		}
+		s.replicas = append(s.replicas, &replica{host: host, pool: pool})
+	}
+
+	s.check()
+	go s.run()
+	return s, nil
+}
+
+// pick returns the pool of the next healthy replica, nil if there is none.
+// Replicas take turns evenly, however many are unhealthy.
+func (s *replicaSet) pick() *pgxpool.Pool {
+	healthy := uint32(0)
+	for _, r := range s.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			healthy++
+		}
+	}
+	if healthy == 0 {
+		return nil
+	}
+	i := atomic.AddUint32(&s.next, 1) % healthy
+	for _, r := range s.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			if i == 0 {
+				return r.pool
+			}
+			i--
+		}
+	}
+	// a replica turned unhealthy meanwhile: read from the primary this time
+	return nil
+}
+
+func (s *replicaSet) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+// check updates the health of every replica.
+func (s *replicaSet) check() {
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+		lag, err := replicationLag(ctx, r.pool)
+		cancel()
+		if err == nil && lag > s.maxLag {
+			err = fmt.Errorf("replication lag %v exceeds %v", lag, s.maxLag)
+		}
+
+		healthy := int32(0)
+		if err == nil {
+			healthy = 1
+		}
+		if old := atomic.SwapInt32(&r.healthy, healthy); old != healthy {
+			if err != nil {
+				s.logger.Warnf("replica %s is unhealthy, reading from other hosts: %v", r.host, err)
+			} else {
+				s.logger.Infof("replica %s is healthy", r.host)
+			}
+		}
+		replicaHealthyGauge.WithLabelValues(r.host).Set(float64(healthy))
+	}
+}
+
+// replicationLag returns how far the replica behind pool is behind its
+// primary. A replica streaming from its primary which replayed all it
+// received is not behind, however old its last replayed transaction; one
+// without a WAL receiver fails with errNotStreaming.
+func replicationLag(ctx context.Context, pool *pgxpool.Pool) (time.Duration, error) {
+	var recovering, streaming bool
+	var seconds float64
+	row := pool.QueryRow(ctx, `
+		SELECT pg_is_in_recovery(),
+			EXISTS (SELECT 1 FROM pg_stat_wal_receiver),
+			CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			END::float8
+	`)
+	if err := row.Scan(&recovering, &streaming, &seconds); err != nil {
+		return 0, fmt.Errorf("checking replication lag: %w", err)
+	}
+	if !recovering {
+		return 0, errNotReplica
+	}
+	if !streaming {
+		return 0, errNotStreaming
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// close stops the checks and closes the replica pools.
+func (s *replicaSet) close() {
+	close(s.stop)
+	<-s.done
+	s.closePools()
+}
+
+func (s *replicaSet) closePools() {
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestReplicaConfig(t *testing.T) {
+	c := &Config{Host: "primary", Port: "5432", Name: "app", ReplicaHosts: []string{"r1", "r2:6432"}}
+
+	r1 := c.replicaConfig("r1")
+	if r1.Host != "r1" || r1.Port != "5432" || r1.Name != "app" || r1.ReplicaHosts != nil {
+		t.Fatalf("got %+v, wanted host r1 on the primary port", r1)
+	}
+	r2 := c.replicaConfig("r2:6432")
+	if r2.Host != "r2" || r2.Port != "6432" {
+		t.Fatalf("got %+v, wanted host r2 port 6432", r2)
+	}
+	if c.Host != "primary" {
+		t.Fatalf("replicaConfig modified the primary config: %+v", c)
+	}
+}
+
+func TestReader(t *testing.T) {
+	primary, p1, p2, p3 := &pgxpool.Pool{}, &pgxpool.Pool{}, &pgxpool.Pool{}, &pgxpool.Pool{}
+	db := &DB{Pool: primary}
+	if db.Reader() != primary || db.Writer() != primary {
+		t.Fatal("wanted the primary without replicas")
+	}
+
+	db.replicas = &replicaSet{replicas: []*replica{
+		{host: "r1", pool: p1, healthy: 1},
+		{host: "r2", pool: p2},
+		{host: "r3", pool: p3, healthy: 1},
+	}}
+	seen := map[*pgxpool.Pool]int{}
+	for i := 0; i < 10; i++ {
+		seen[db.Reader()]++
+	}
+	if seen[p1] != 5 || seen[p3] != 5 {
+		t.Fatalf("got %v, wanted reads shared between the healthy replicas", seen)
+	}
+	if db.Writer() != primary {
+		t.Fatal("Writer did not return the primary")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { db.Reader() }); allocs != 0 {
+		t.Fatalf("got %v allocations per read, wanted none", allocs)
+	}
+
+	db.replicas.replicas[0].healthy = 0
+	db.replicas.replicas[2].healthy = 0
+	if db.Reader() != primary {
+		t.Fatal("wanted the primary without healthy replicas")
+	}
+}
+
+func TestReplicaCheck(t *testing.T) {
+	t.Parallel()
+
+	db, conf := NewTestDatabaseWithConfig(t)
+	ctx := context.Background()
+
+	// The primary is not a replica: it fails the check and reads fall back to it.
+	conf.ReplicaHosts = []string{conf.Host}
+	replicas, err := newReplicaSet(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replicas.close()
+	if _, err := replicationLag(ctx, replicas.replicas[0].pool); err != errNotReplica {
+		t.Fatalf("got %v, wanted %v", err, errNotReplica)
+	}
+
+	rdb := &DB{Pool: db.Pool, replicas: replicas}
+	if rdb.Reader() != db.Pool {
+		t.Fatal("wanted reads from the primary")
+	}
+	if err := rdb.InReadTx(ctx, "", func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO Lock (lock_id, expires) VALUES ('read-only', now())`)
+		return err
+	}); err == nil {
+		t.Fatal("wrote in a read-only transaction")
+	}
+}
@@ -0,0 +1,263 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jusongchen/REST-app/pkg/logging"
+)
+
+// migrationsTable is where golang-migrate records the schema version.
+const migrationsTable = "schema_migrations"
+
+// SchemaObject is a table, column, index, constraint or function of a schema.
+type SchemaObject struct {
+	Kind string
+	// Name identifies the object within its kind, e.g. "task.status" for a column.
+	Name string
+	// Definition is compared to detect changes, e.g. the type of a column.
+	Definition string
+}
+
+// Schema lists the objects of a database schema, sorted by kind and name.
+type Schema []SchemaObject
+
+// schemaQueries introspect a schema, named $1, returning the kind, name and
+// definition of its objects.
+var schemaQueries = []string{
+	`SELECT 'table', table_name, ''
+	FROM information_schema.tables
+	WHERE table_schema = $1 AND table_type = 'BASE TABLE'`,
+
+	`SELECT 'column', table_name || '.' || column_name,
+		data_type
+		|| COALESCE('(' || character_maximum_length || ')', '')
+		|| CASE WHEN is_nullable = 'NO' THEN ' NOT NULL' ELSE '' END
+		|| COALESCE(' DEFAULT ' || column_default, '')
+	FROM information_schema.columns
+	WHERE table_schema = $1`,
+
+	`SELECT 'index', indexname, indexdef
+	FROM pg_indexes
+	WHERE schemaname = $1`,
+
+	`SELECT 'constraint', t.relname || '.' || c.conname, pg_get_constraintdef(c.oid)
+	FROM pg_constraint c
+	JOIN pg_class t ON t.oid = c.conrelid
+	JOIN pg_namespace n ON n.oid = t.relnamespace
+	WHERE n.nspname = $1`,
+
+	`SELECT 'function', p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')', pg_get_functiondef(p.oid)
+	FROM pg_proc p
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE n.nspname = $1 AND p.prokind = 'f'`,
+}
+
+// SnapshotSchema describes the objects of the public schema of db.
+func (db *DB) SnapshotSchema(ctx context.Context) (Schema, error) {
+	var s Schema
+	for _, q := range schemaQueries {
+		rows, err := db.Pool.Query(ctx, q, "public")
+		if err != nil {
+			return nil, fmt.Errorf("introspecting schema: %w", err)
+		}
+		for rows.Next() {
+			var o SchemaObject
+			if err := rows.Scan(&o.Kind, &o.Name, &o.Definition); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("introspecting schema: %w", err)
+			}
+			s = append(s, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("introspecting schema: %w", err)
+		}
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Kind != s[j].Kind {
+			return s[i].Kind < s[j].Kind
+		}
+		return s[i].Name < s[j].Name
+	})
+	return s, nil
+}
+
+// SchemaDiff is an object which differs between two schemas. Want is nil for
+// an unexpected object, Got is nil for a missing one.
+type SchemaDiff struct {
+	Want *SchemaObject
+	Got  *SchemaObject
+}
+
+func (d SchemaDiff) String() string {
+	switch {
+	case d.Want == nil:
+		return fmt.Sprintf("unexpected %s %s: %s", d.Got.Kind, d.Got.Name, d.Got.Definition)
+	case d.Got == nil:
+		return fmt.Sprintf("missing %s %s: %s", d.Want.Kind, d.Want.Name, d.Want.Definition)
+	default:
+		return fmt.Sprintf("changed %s %s: want %s, got %s", d.Want.Kind, d.Want.Name, d.Want.Definition, d.Got.Definition)
+	}
+}
+
+// DiffSchemas lists the objects of got which are missing, unexpected or
+// changed compared to want.
+func DiffSchemas(want, got Schema) []SchemaDiff {
+	type key struct{ kind, name string }
+	index := func(s Schema) map[key]*SchemaObject {
+		m := make(map[key]*SchemaObject, len(s))
+		for i := range s {
+			m[key{s[i].Kind, s[i].Name}] = &s[i]
+		}
+		return m
+	}
+	wants, gots := index(want), index(got)
+
+	var diffs []SchemaDiff
+	for i := range want {
+		w := &want[i]
+		g, ok := gots[key{w.Kind, w.Name}]
+		switch {
+		case !ok:
+			diffs = append(diffs, SchemaDiff{Want: w})
+		case g.Definition != w.Definition:
+			diffs = append(diffs, SchemaDiff{Want: w, Got: g})
+		}
+	}
+	for i := range got {
+		g := &got[i]
+		if _, ok := wants[key{g.Kind, g.Name}]; !ok {
+			diffs = append(diffs, SchemaDiff{Got: g})
+		}
+	}
+	return diffs
+}
+
+// SchemaReport is the outcome of VerifySchema.
+type SchemaReport struct {
+	// Drift lists how the target database differs from its migrations.
+	Drift []SchemaDiff
+	// Irreversible lists what differs after migrating up, down and up again,
+	// and what migrating all the way down left behind.
+	Irreversible []SchemaDiff
+}
+
+// OK reports whether no problem was found.
+func (r *SchemaReport) OK() bool {
+	return len(r.Drift) == 0 && len(r.Irreversible) == 0
+}
+
+// VerifySchema compares the database of config to the schema the migrations
+// in fsys produce. The migrations are applied to a scratch database, created
+// on the same server and dropped afterwards, up then down then up again to
+// prove they are reversible. The user of config needs the CREATEDB privilege.
+func VerifySchema(ctx context.Context, config *Config, fsys fs.FS) (*SchemaReport, error) {
+	target, err := NewFromEnv(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer target.Close(ctx)
+
+	got, err := target.SnapshotSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	scratchConfig := *config
+	scratchConfig.Name = "schema_verify_" + hex.EncodeToString(b[:])
+	if _, err := target.Pool.Exec(ctx, `CREATE DATABASE `+pgx.Identifier{scratchConfig.Name}.Sanitize()); err != nil {
+		return nil, fmt.Errorf("creating scratch database: %w", err)
+	}
+	defer func() {
+		// Clean up even if ctx is done.
+		if _, err := target.Pool.Exec(context.Background(), `DROP DATABASE IF EXISTS `+pgx.Identifier{scratchConfig.Name}.Sanitize()); err != nil {
+			logging.FromContext(ctx).Errorf("dropping scratch database %s: %v", scratchConfig.Name, err)
+		}
+	}()
+
+	want, irreversible, err := migrateScratch(ctx, &scratchConfig, fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaReport{
+		Drift:        DiffSchemas(want, got),
+		Irreversible: irreversible,
+	}, nil
+}
+
+// migrateScratch migrates the empty database of config up, down and up again.
+// It returns the schema after the first migration up and the differences
+// found along the way.
+func migrateScratch(ctx context.Context, config *Config, fsys fs.FS) (Schema, []SchemaDiff, error) {
+	db, err := NewFromEnv(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close(ctx)
+
+	connURL, err := config.ConnectionURL(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := NewMigrator(connURL, fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer m.Close()
+
+	up := func() (Schema, error) {
+		if err := m.Up(); err != nil {
+			return nil, fmt.Errorf("migrating scratch database up: %w", err)
+		}
+		return db.SnapshotSchema(ctx)
+	}
+
+	// The migrator created its version table already.
+	empty, err := db.SnapshotSchema(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	first, err := up()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.DownAll(); err != nil {
+		return nil, nil, fmt.Errorf("migrating scratch database down: %w", err)
+	}
+	down, err := db.SnapshotSchema(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := up()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diffs := DiffSchemas(empty.without(migrationsTable), down.without(migrationsTable))
+	diffs = append(diffs, DiffSchemas(first, second)...)
+	return first, diffs, nil
+}
+
+// without returns s without the objects of table: the table itself, its
+// columns and constraints, and its primary key index.
+func (s Schema) without(table string) Schema {
+	var out Schema
+	for _, o := range s {
+		if o.Name == table || strings.HasPrefix(o.Name, table+".") || o.Kind == "index" && o.Name == table+"_pkey" {
+			continue
+		}
+		out = append(out, o)
+	}
+	return out
+}
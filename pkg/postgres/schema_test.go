@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jusongchen/REST-app/migration"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	want := Schema{
+		{Kind: "column", Name: "task.id", Definition: "bigint NOT NULL"},
+		{Kind: "column", Name: "task.status", Definition: "character varying(20) NOT NULL"},
+		{Kind: "table", Name: "task"},
+	}
+	got := Schema{
+		{Kind: "column", Name: "task.hotfix", Definition: "integer"},
+		{Kind: "column", Name: "task.id", Definition: "bigint NOT NULL"},
+		{Kind: "column", Name: "task.status", Definition: "text NOT NULL"},
+	}
+
+	var lines []string
+	for _, d := range DiffSchemas(want, got) {
+		lines = append(lines, d.String())
+	}
+	wantLines := []string{
+		"changed column task.status: want character varying(20) NOT NULL, got text NOT NULL",
+		"missing table task: ",
+		"unexpected column task.hotfix: integer",
+	}
+	if strings.Join(lines, "\n") != strings.Join(wantLines, "\n") {
+		t.Fatalf("got diffs\n%s\nwanted\n%s", strings.Join(lines, "\n"), strings.Join(wantLines, "\n"))
+	}
+
+	if diffs := DiffSchemas(want, want); len(diffs) != 0 {
+		t.Fatalf("got diffs %v between identical schemas", diffs)
+	}
+}
+
+func TestSchemaWithout(t *testing.T) {
+	s := Schema{
+		{Kind: "column", Name: "schema_migrations.version"},
+		{Kind: "column", Name: "schema_migrations_extra.id"},
+		{Kind: "constraint", Name: "schema_migrations.schema_migrations_pkey"},
+		{Kind: "index", Name: "schema_migrations_pkey"},
+		{Kind: "table", Name: "schema_migrations"},
+		{Kind: "table", Name: "schema_migrations_extra"},
+	}
+	got := s.without(migrationsTable)
+	if len(got) != 2 || got[0].Name != "schema_migrations_extra.id" || got[1].Name != "schema_migrations_extra" {
+		t.Fatalf("got %v, wanted only the objects of schema_migrations_extra", got)
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	t.Parallel()
+
+	db, conf := NewTestDatabaseWithConfig(t)
+	ctx := context.Background()
+
+	report, err := VerifySchema(ctx, conf, migration.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("got drift %v and irreversible changes %v on a migrated database", report.Drift, report.Irreversible)
+	}
+
+	// A hotfix applied by hand is reported.
+	if _, err := db.Pool.Exec(ctx, `ALTER TABLE task ADD COLUMN hotfix INT`); err != nil {
+		t.Fatal(err)
+	}
+	report, err = VerifySchema(ctx, conf, migration.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Drift) != 1 || report.Drift[0].Got == nil || report.Drift[0].Got.Name != "task.hotfix" {
+		t.Fatalf("got drift %v, wanted the unexpected column task.hotfix", report.Drift)
+	}
+	if len(report.Irreversible) != 0 {
+		t.Fatalf("got irreversible changes %v", report.Irreversible)
+	}
+}
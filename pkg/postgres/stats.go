@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStats are the figures of a connection pool.
+type PoolStats struct {
+	// Pool is "primary" or the host of a replica.
+	Pool string `json:"pool"`
+
+	AcquiredConns int32 `json:"acquired_conns"`
+	IdleConns     int32 `json:"idle_conns"`
+	TotalConns    int32 `json:"total_conns"`
+	MaxConns      int32 `json:"max_conns"`
+
+	AcquireCount int64 `json:"acquire_count"`
+	// WaitCount counts the acquisitions which waited for a connection to be
+	// released or established: a growing count means the pool is saturated.
+	WaitCount            int64         `json:"wait_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireDuration      time.Duration `json:"acquire_duration"`
+}
+
+func poolStats(name string, pool *pgxpool.Pool) PoolStats {
+	s := pool.Stat()
+	return PoolStats{
+		Pool:                 name,
+		AcquiredConns:        s.AcquiredConns(),
+		IdleConns:            s.IdleConns(),
+		TotalConns:           s.TotalConns(),
+		MaxConns:             s.MaxConns(),
+		AcquireCount:         s.AcquireCount(),
+		WaitCount:            s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireDuration:      s.AcquireDuration(),
+	}
+}
+
+// Stats returns the figures of the pool of the primary, then of the replicas.
+func (db *DB) Stats() []PoolStats {
+	stats := []PoolStats{poolStats("primary", db.Pool)}
+	if db.replicas != nil {
+		for _, r := range db.replicas.replicas {
+			stats = append(stats, poolStats(r.host, r.pool))
+		}
+	}
+	return stats
+}
+
+// StatsHandler serves Stats as JSON.
+func (db *DB) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(db.Stats())
+	})
+}
+
+var poolMetrics = newPoolCollector()
+
+func init() {
+	prometheus.MustRegister(poolMetrics)
+}
+
+// poolCollector exports the Stats of the open DBs, labelled by database name
+// and pool.
+type poolCollector struct {
+	mu  sync.Mutex
+	dbs map[*DB]string
+
+	acquired, idle, total, max                    *prometheus.Desc
+	acquireCount, waitCount, canceled, acquireDur *prometheus.Desc
+}
+
+func newPoolCollector() *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, []string{"database", "pool"}, nil)
+	}
+	return &poolCollector{
+		dbs:          make(map[*DB]string),
+		acquired:     desc("db_pool_acquired_conns", "Connections currently in use."),
+		idle:         desc("db_pool_idle_conns", "Connections currently idle."),
+		total:        desc("db_pool_total_conns", "Connections open or being established."),
+		max:          desc("db_pool_max_conns", "Maximum size of the pool."),
+		acquireCount: desc("db_pool_acquires_total", "Connections acquired from the pool."),
+		waitCount:    desc("db_pool_acquire_waits_total", "Acquisitions which waited for a connection."),
+		canceled:     desc("db_pool_canceled_acquires_total", "Acquisitions canceled by their context."),
+		acquireDur:   desc("db_pool_acquire_seconds_total", "Time spent acquiring connections."),
+	}
+}
+
+func (c *poolCollector) add(db *DB, database string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbs[db] = database
+}
+
+func (c *poolCollector) remove(db *DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.dbs, db)
+}
+
+// Describe implements prometheus.Collector.
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.acquired, c.idle, c.total, c.max, c.acquireCount, c.waitCount, c.canceled, c.acquireDur} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Two DBs open on the same database, e.g. while one is being replaced,
+	// must not export the same series twice.
+	seen := make(map[[2]string]bool)
+	for db, database := range c.dbs {
+		for _, s := range db.Stats() {
+			key := [2]string{database, s.Pool}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			gauge := func(d *prometheus.Desc, v int32) {
+				ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, float64(v), database, s.Pool)
+			}
+			counter := func(d *prometheus.Desc, v float64) {
+				ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, database, s.Pool)
+			}
+			gauge(c.acquired, s.AcquiredConns)
+			gauge(c.idle, s.IdleConns)
+			gauge(c.total, s.TotalConns)
+			gauge(c.max, s.MaxConns)
+			counter(c.acquireCount, float64(s.AcquireCount))
+			counter(c.waitCount, float64(s.WaitCount))
+			counter(c.canceled, float64(s.CanceledAcquireCount))
+			counter(c.acquireDur, s.AcquireDuration.Seconds())
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	newLazyPool := func() *pgxpool.Pool {
+		conf, err := pgxpool.ParseConfig("host=localhost dbname=stats pool_max_conns=3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.LazyConnect = true
+		pool, err := pgxpool.ConnectConfig(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		return pool
+	}
+	db := &DB{Pool: newLazyPool(), replicas: &replicaSet{replicas: []*replica{{host: "r1", pool: newLazyPool()}}}}
+
+	stats := db.Stats()
+	if len(stats) != 2 || stats[0].Pool != "primary" || stats[1].Pool != "r1" || stats[0].MaxConns != 3 {
+		t.Fatalf("got %+v, wanted the primary then r1 with 3 connections at most", stats)
+	}
+
+	rec := httptest.NewRecorder()
+	db.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var served []PoolStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil || len(served) != 2 {
+		t.Fatalf("got %s, err %v, wanted the stats of both pools", rec.Body, err)
+	}
+
+	// A second DB on the same database does not duplicate series.
+	c := newPoolCollector()
+	c.add(db, "stats")
+	c.add(&DB{Pool: db.Pool}, "stats")
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+	if n := len(ch); n != 2*8 {
+		t.Fatalf("got %d metrics, wanted 8 for each of 2 pools", n)
+	}
+}
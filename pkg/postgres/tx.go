@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jusongchen/REST-app/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sethvargo/go-retry"
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+var (
+	txRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_tx_retries_total",
+		Help: "Transactions retried by InTx, by SQLSTATE of the failed attempt.",
+	}, []string{"sqlstate"})
+
+	txFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_tx_failures_total",
+		Help: "Transactions InTx gave up on because of a database error, by SQLSTATE.",
+	}, []string{"sqlstate"})
+)
+
+// TxOption customizes a transaction run by InTx.
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	tx               pgx.TxOptions
+	statementTimeout time.Duration
+	maxRetries       *int
+}
+
+// ReadOnly starts a READ ONLY transaction.
+func ReadOnly() TxOption {
+	return func(o *txOptions) {
+		o.tx.AccessMode = pgx.ReadOnly
+	}
+}
+
+// Deferrable starts a DEFERRABLE transaction: a serializable read-only
+// transaction then waits for a snapshot which cannot cause serialization
+// failures, instead of risking one.
+func Deferrable() TxOption {
+	return func(o *txOptions) {
+		o.tx.DeferrableMode = pgx.Deferrable
+	}
+}
+
+// WithStatementTimeout aborts the statements of the transaction running for
+// longer than d.
+func WithStatementTimeout(d time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.statementTimeout = d
+	}
+}
+
+// WithTxRetries overrides the retry budget of the DB: a transaction is
+// attempted at most n+1 times. Zero disables retries.
+func WithTxRetries(n int) TxOption {
+	return func(o *txOptions) {
+		o.maxRetries = &n
+	}
+}
+
+// InSavepoint runs f within a savepoint of tx: if f fails, what it did is
+// rolled back but the transaction carries on. Savepoints nest.
+func InSavepoint(ctx context.Context, tx pgx.Tx, f func(tx pgx.Tx) error) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("creating savepoint: %w", err)
+	}
+	if err := f(sp); err != nil {
+		if err1 := sp.Rollback(ctx); err1 != nil {
+			return fmt.Errorf("rolling back to savepoint: %v (original error: %w)", err1, err)
+		}
+		return err
+	}
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("releasing savepoint: %w", err)
+	}
+	return nil
+}
+
+// inTx runs f in a transaction on pool, retrying serialization failures and
+// deadlocks within the retry budget. Database errors are classified.
+func (db *DB) inTx(ctx context.Context, pool *pgxpool.Pool, isoLevel pgx.TxIsoLevel, f func(tx pgx.Tx) error, opts []TxOption) error {
+	o := txOptions{tx: pgx.TxOptions{IsoLevel: isoLevel}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	maxRetries := db.txMaxRetries
+	if o.maxRetries != nil {
+		maxRetries = *o.maxRetries
+	}
+
+	b, err := retry.NewExponential(db.txRetryBackoff)
+	if err != nil {
+		// A zero backoff retries at once.
+		b = retry.BackoffFunc(func() (time.Duration, bool) { return 0, false })
+	}
+	b = retry.WithJitterPercent(50, b)
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, pool, &o, f)
+		code := sqlState(err)
+		if err == nil || code != serializationFailure && code != deadlockDetected || attempt >= maxRetries {
+			if code != "" {
+				txFailures.WithLabelValues(code).Inc()
+			}
+			return Classify(err)
+		}
+
+		txRetries.WithLabelValues(code).Inc()
+		next, _ := b.Next()
+		logging.FromContext(ctx).Debugf("Retrying transaction in %v after attempt %d failed: %v", next, attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return Classify(err)
+		case <-time.After(next):
+		}
+	}
+}
+
+// runTx runs f once in a transaction on pool.
+func runTx(ctx context.Context, pool *pgxpool.Pool, o *txOptions, f func(tx pgx.Tx) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.BeginTx(ctx, o.tx)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	err = setStatementTimeout(ctx, tx, o.statementTimeout)
+	if err == nil {
+		err = f(tx)
+	}
+	if err != nil {
+		if err1 := tx.Rollback(ctx); err1 != nil {
+			return fmt.Errorf("rolling back transaction: %v (original error: %w)", err1, err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// setStatementTimeout sets the statement timeout of tx, if d is positive.
+func setStatementTimeout(ctx context.Context, tx pgx.Tx, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)); err != nil {
+		return fmt.Errorf("setting statement timeout: %w", err)
+	}
+	return nil
+}
+
+// sqlState returns the SQLSTATE of err, empty if it is not a Postgres error.
+func sqlState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	pgx "github.com/jackc/pgx/v4"
+)
+
+func TestSQLState(t *testing.T) {
+	err := fmt.Errorf("committing transaction: %w", &pgconn.PgError{Code: serializationFailure})
+	if got := sqlState(err); got != serializationFailure {
+		t.Fatalf("got %q, wanted %q", got, serializationFailure)
+	}
+	if got := sqlState(errors.New("boom")); got != "" {
+		t.Fatalf("got %q for a non Postgres error", got)
+	}
+}
+
+func TestInTxRetry(t *testing.T) {
+	t.Parallel()
+
+	db := NewTestDatabase(t)
+	ctx := context.Background()
+
+	failures := func(n int, code string) (func(tx pgx.Tx) error, *int) {
+		attempts := 0
+		return func(tx pgx.Tx) error {
+			attempts++
+			if attempts <= n {
+				return &pgconn.PgError{Code: code}
+			}
+			return nil
+		}, &attempts
+	}
+
+	f, attempts := failures(2, serializationFailure)
+	if err := db.InTx(ctx, pgx.Serializable, f); err != nil || *attempts != 3 {
+		t.Fatalf("got %v after %d attempts, wanted success after 3", err, *attempts)
+	}
+
+	f, attempts = failures(2, deadlockDetected)
+	err := db.InTx(ctx, pgx.Serializable, f, WithTxRetries(1))
+	if sqlState(err) != deadlockDetected || *attempts != 2 {
+		t.Fatalf("got %v after %d attempts, wanted a deadlock after 2", err, *attempts)
+	}
+
+	f, attempts = failures(1, "23505")
+	if err := db.InTx(ctx, pgx.Serializable, f); sqlState(err) != "23505" || *attempts != 1 {
+		t.Fatalf("got %v after %d attempts, wanted a unique violation at once", err, *attempts)
+	}
+}
+
+func TestInTxOptions(t *testing.T) {
+	t.Parallel()
+
+	db := NewTestDatabase(t)
+	ctx := context.Background()
+
+	err := db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO Lock (lock_id, expires) VALUES ('read-only', now())`)
+		return err
+	}, ReadOnly())
+	if got := sqlState(err); got != "25006" {
+		t.Fatalf("got %v, wanted read_only_sql_transaction", err)
+	}
+
+	err = db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `SELECT pg_sleep(1)`)
+		return err
+	}, WithStatementTimeout(10*time.Millisecond))
+	if got := sqlState(err); got != "57014" {
+		t.Fatalf("got %v, wanted query_canceled", err)
+	}
+
+	if err := db.InTx(ctx, pgx.Serializable, func(tx pgx.Tx) error {
+		var one int
+		return tx.QueryRow(ctx, `SELECT 1`).Scan(&one)
+	}, ReadOnly(), Deferrable()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInSavepoint(t *testing.T) {
+	t.Parallel()
+
+	db := NewTestDatabase(t)
+	ctx := context.Background()
+
+	insert := func(tx pgx.Tx, id string) error {
+		_, err := tx.Exec(ctx, `INSERT INTO Lock (lock_id, expires) VALUES ($1, now() + interval '1 minute')`, id)
+		return err
+	}
+	errRollback := errors.New("rollback")
+	err := db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		if err := insert(tx, "savepoint-kept"); err != nil {
+			return err
+		}
+		err := InSavepoint(ctx, tx, func(tx pgx.Tx) error {
+			if err := insert(tx, "savepoint-nested-kept"); err != nil {
+				return err
+			}
+			return InSavepoint(ctx, tx, func(tx pgx.Tx) error {
+				if err := insert(tx, "savepoint-discarded"); err != nil {
+					return err
+				}
+				return errRollback
+			})
+		})
+		if !errors.Is(err, errRollback) {
+			return fmt.Errorf("got %v, wanted %v", err, errRollback)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	rows, err := db.Pool.Query(ctx, `SELECT lock_id FROM Lock WHERE lock_id LIKE 'savepoint-%' ORDER BY lock_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if fmt.Sprint(ids) != "[savepoint-kept savepoint-nested-kept]" {
+		t.Fatalf("got locks %v, wanted the ones outside the rolled back savepoint", ids)
+	}
+}
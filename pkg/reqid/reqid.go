@@ -0,0 +1,27 @@
+// Package reqid carries the ID of a request in its context, so that the
+// packages logging on behalf of a request do not depend on its HTTP stack.
+package reqid
+
+import "context"
+
+type ctxKey int
+
+// Key is the key that holds the request ID in a context.
+const Key ctxKey = 0
+
+// NewContext returns a copy of ctx carrying the request ID id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, Key, id)
+}
+
+// FromContext returns the request ID of ctx, or the empty string if it has
+// none.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(Key).(string); ok {
+		return id
+	}
+	return ""
+}
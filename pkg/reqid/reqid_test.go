@@ -0,0 +1,16 @@
+package reqid
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if got := FromContext(ctx); got != "" {
+		t.Fatalf("got %q from a context without request ID", got)
+	}
+	if got := FromContext(NewContext(ctx, "host/abc-000001")); got != "host/abc-000001" {
+		t.Fatalf("got %q, wanted host/abc-000001", got)
+	}
+}
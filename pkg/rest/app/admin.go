@@ -0,0 +1,71 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/jusongchen/REST-app/pkg/logging"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//PprofPath serves the runtime profiles on the admin listener
+	PprofPath = "/debug/pprof/"
+	//LogLevelPath reads and, with PUT, sets the log level on the admin listener
+	LogLevelPath = "/debug/loglevel"
+)
+
+//HandleAdmin serves handler at path on the admin listener, or on the public one when
+//AdminHost is not set. It must be called before Start
+func (a *Instance) HandleAdmin(path string, handler http.Handler) {
+	if a.adminMux != nil {
+		a.adminMux.Handle(path, handler)
+		return
+	}
+	a.Container.Handle(path, handler)
+}
+
+//handlePprof serves the net/http/pprof profiles on mux
+func handlePprof(mux *http.ServeMux) {
+	mux.HandleFunc(PprofPath, pprof.Index)
+	mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+}
+
+//SetLogLevel sets the default log level, see logging.SetDefaultLevel, and the level of
+//the server log when it knows the level, so that both loggers agree
+func SetLogLevel(level string) error {
+	if err := logging.SetDefaultLevel(level); err != nil {
+		return err
+	}
+	if l, err := log.ParseLevel(level); err == nil {
+		log.SetLevel(l)
+	}
+	return nil
+}
+
+//logLevel serves the default log level. A PUT with ?level=debug changes it, see SetLogLevel
+func logLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			level := r.URL.Query().Get("level")
+			if err := SetLogLevel(level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Infof("log level set to %s", level)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"level": logging.GetDefaultLogLevel().String()})
+	}
+}
@@ -4,18 +4,23 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/jusongchen/REST-app/pkg/config"
 	"github.com/jusongchen/REST-app/pkg/rest/swagger"
 
 	"github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -33,14 +38,126 @@ const (
 	MetricsPath = "/metrics"
 	// UIPath is the default path for application UI access
 	UIPath = "/ui/"
+	//InfoPath serves the build of the server, and its dependencies and settings to admins
+	InfoPath = "/info"
+	//ReloadPath serves the result of the last configuration reload
+	ReloadPath = "/debug/config/reload"
+
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 //Config is used to keep common App config
 type Config struct {
-	SwaggerDir string `json:"swagger_dir,omitempty" required:"true" envconfig:"SWAGGER_UI_PATH" env:"SWAGGER_UI_PATH,required"`
-	Port       uint   `json:"port,omitempty" default:"0" required:"true" envconfig:"PORT" env:"PORT,default=0"`
-	Host       string `json:"host,omitempty" default:"0.0.0.0" required:"true" envconfig:"HOST" env:"HOST,default=0.0.0.0"`
-	About      string `json:"about,omitempty" `
+	SwaggerDir string `json:"swagger_dir,omitempty" env:"SWAGGER_UI_PATH" info:"true"`
+	Port       uint   `json:"port,omitempty" env:"PORT,default=0" info:"true"`
+	//Host is an IP, a hostname resolved at startup, which gets a listener for each of its IPs,
+	//or * for all the interfaces. 0.0.0.0, :: and * listen on IPv4 and IPv6 both
+	Host string `json:"host,omitempty" env:"HOST,default=0.0.0.0" info:"true"`
+	//Listen, when set, are the addresses of the public listeners instead of HOST and PORT, comma
+	//separated: host:port as HOST, e.g. [::1]:8080 or localhost:8080, tcp://host:port,
+	//unix:///run/demoapp.sock?mode=0660, or fd://, fd://N or fd://name for the sockets passed
+	//by systemd socket activation. With a port 0, each listener gets a port of its own
+	Listen []string `json:"listen,omitempty" env:"LISTEN" info:"true"`
+	//ShutdownTimeout bounds how long Close waits for components to stop
+	ShutdownTimeout time.Duration `json:"shutdown_timeout,omitempty" env:"SHUTDOWN_TIMEOUT,default=30s" info:"true"`
+	//ConfigWatchInterval is how often the config file is checked for changes, 0 disables the check
+	ConfigWatchInterval time.Duration `json:"config_watch_interval,omitempty" env:"CONFIG_WATCH_INTERVAL,default=0" info:"true"`
+	//ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout bound the time a client may take
+	//to send headers, send a request, read a response and keep an idle connection. 0 is no limit
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout,omitempty" env:"READ_HEADER_TIMEOUT,default=10s" info:"true"`
+	ReadTimeout       time.Duration `json:"read_timeout,omitempty" env:"READ_TIMEOUT,default=30s" info:"true"`
+	WriteTimeout      time.Duration `json:"write_timeout,omitempty" env:"WRITE_TIMEOUT,default=60s" info:"true"`
+	IdleTimeout       time.Duration `json:"idle_timeout,omitempty" env:"IDLE_TIMEOUT,default=120s" info:"true"`
+	//MaxHeaderBytes bounds the size of request headers, 0 is net/http's default of 1MB
+	MaxHeaderBytes int `json:"max_header_bytes,omitempty" env:"MAX_HEADER_BYTES,default=65536" info:"true"`
+	//MaxConnections bounds the open connections of the public listener, the ones beyond are closed. 0 is no limit
+	MaxConnections int `json:"max_connections,omitempty" env:"MAX_CONNECTIONS,default=0" info:"true"`
+	//MaxRequestBodyBytes bounds request bodies of the routes not setting KeyMaxBodyBytes. 0 is no limit
+	MaxRequestBodyBytes int64 `json:"max_request_body_bytes,omitempty" env:"MAX_REQUEST_BODY_BYTES,default=1048576" info:"true"`
+	//TLSCertFile and TLSKeyFile, when set, make the public listener serve HTTPS
+	TLSCertFile string `json:"tls_cert_file,omitempty" env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `json:"tls_key_file,omitempty" env:"TLS_KEY_FILE"`
+	//HTTP2 enables HTTP/2 over TLS
+	HTTP2 bool `json:"http2" env:"HTTP2,default=true" info:"true"`
+	//H2C enables HTTP/2 without TLS, as spoken between pods of the mesh
+	H2C bool `json:"h2c,omitempty" env:"H2C,default=false" info:"true"`
+	//HTTP3 serves HTTP/3 over QUIC on the UDP port of the public listener and advertises it
+	//with Alt-Svc. It is experimental, needs TLS and an HTTP3Server, see SetHTTP3
+	HTTP3 bool `json:"http3,omitempty" env:"HTTP3,default=false" info:"true"`
+	//AdminHost, when set, moves the probes, metrics and debug endpoints from the public
+	//listener to one on AdminHost:AdminPort, not to be exposed through the public ingress
+	AdminHost string `json:"admin_host,omitempty" env:"ADMIN_HOST"`
+	AdminPort uint   `json:"admin_port,omitempty" env:"ADMIN_PORT,default=0"`
+	//AdminToken is the bearer token of admin requests, no request is admin when it is empty
+	AdminToken string `json:"-" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+//Validate checks the settings of s
+func (s Config) Validate() error {
+	var errs config.Errors
+	if s.SwaggerDir == "" {
+		errs.Add(errors.New("SWAGGER_UI_PATH is required"))
+	}
+	if s.Port > 65535 {
+		errs.Add(fmt.Errorf("PORT must be a port number, got %d", s.Port))
+	}
+	if err := checkHost(s.Host); err != nil {
+		errs.Add(fmt.Errorf("HOST must be an IP address, a hostname or *: %v", err))
+	}
+	for _, l := range s.Listen {
+		if err := checkListenAddr(l); err != nil {
+			errs.Add(fmt.Errorf("LISTEN must be host:port addresses or listener URLs, %q: %v", l, err))
+		}
+	}
+	if s.ShutdownTimeout < 0 {
+		errs.Add(fmt.Errorf("SHUTDOWN_TIMEOUT must not be negative, got %v", s.ShutdownTimeout))
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"READ_HEADER_TIMEOUT", s.ReadHeaderTimeout},
+		{"READ_TIMEOUT", s.ReadTimeout},
+		{"WRITE_TIMEOUT", s.WriteTimeout},
+		{"IDLE_TIMEOUT", s.IdleTimeout},
+	} {
+		if t.d < 0 {
+			errs.Add(fmt.Errorf("%s must not be negative, got %v", t.name, t.d))
+		}
+	}
+	if s.MaxHeaderBytes < 0 {
+		errs.Add(fmt.Errorf("MAX_HEADER_BYTES must not be negative, got %d", s.MaxHeaderBytes))
+	}
+	if s.MaxConnections < 0 {
+		errs.Add(fmt.Errorf("MAX_CONNECTIONS must not be negative, got %d", s.MaxConnections))
+	}
+	if s.MaxRequestBodyBytes < 0 {
+		errs.Add(fmt.Errorf("MAX_REQUEST_BODY_BYTES must not be negative, got %d", s.MaxRequestBodyBytes))
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		errs.Add(errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if s.H2C && s.TLSCertFile != "" {
+		errs.Add(errors.New("H2C is HTTP/2 without TLS, it cannot be set with TLS_CERT_FILE"))
+	}
+	if s.HTTP3 && s.TLSCertFile == "" {
+		errs.Add(errors.New("HTTP3 needs TLS_CERT_FILE and TLS_KEY_FILE"))
+	}
+	if s.AdminHost != "" {
+		if err := checkHost(s.AdminHost); err != nil {
+			errs.Add(fmt.Errorf("ADMIN_HOST must be an IP address, a hostname or *: %v", err))
+		}
+		if s.AdminPort > 65535 {
+			errs.Add(fmt.Errorf("ADMIN_PORT must be a port number, got %d", s.AdminPort))
+		}
+		if s.AdminPort != 0 && s.AdminPort == s.Port {
+			errs.Add(fmt.Errorf("ADMIN_PORT must differ from PORT, both are %d", s.Port))
+		}
+	}
+	if s.ConfigWatchInterval < 0 {
+		errs.Add(fmt.Errorf("CONFIG_WATCH_INTERVAL must not be negative, got %v", s.ConfigWatchInterval))
+	}
+	return errs.Err()
 }
 
 var _ fmt.Stringer = Config{}
@@ -56,10 +173,36 @@ type Instance struct {
 	Config
 	Container *restful.Container `json:"-"`
 	Svr       *Server            `json:"-"`
-	isReady   *atomic.Value
+	//AdminSvr serves the admin endpoints when AdminHost is set, nil otherwise
+	AdminSvr *Server `json:"-"`
+	adminMux *http.ServeMux
+	isReady  *atomic.Value
+	http3    HTTP3Server
+	docs     *swagger.Docs
+
+	components []Component
+	onShutdown []func(ctx context.Context) error
+	statuses   []status
+	reloads    reloads
+	build      BuildInfo
+	settings   func() []config.Setting
+}
+
+//status is a named part of the home page
+type status struct {
+	name string
+	fn   func() interface{}
+}
+
+//Component is a background service which lives as long as the server, e.g. a worker pool
+type Component interface {
+	//Start starts the component and returns immediately
+	Start() error
+	//Stop stops the component, giving up on a graceful stop when ctx is done
+	Stop(ctx context.Context) error
 }
 
-//New init a new application instance
+//New init a new application instance serving ws, see Mount to serve other handlers
 func New(conf Config, info swagger.ServerInfo, ws ...*restful.WebService) (*Instance, error) {
 
 	var err error
@@ -72,65 +215,247 @@ func New(conf Config, info swagger.ServerInfo, ws ...*restful.WebService) (*Inst
 		return nil, fmt.Errorf("failed to get CWD:%v", err)
 	}
 
-	address := net.ParseIP(a.Host)
-	if address == nil {
-		return nil, fmt.Errorf("cannot parse host IP:%s", a.Host)
-	}
 	if _, err := os.Stat(a.SwaggerDir); os.IsNotExist(err) {
 		return nil, fmt.Errorf("swaggerUI dir does not exist:%s.  working dir:%s", a.SwaggerDir, cwd)
 	}
 
-	addr := net.JoinHostPort(address.String(), strconv.FormatUint(uint64(a.Port), 10))
+	addrs := a.Listen
+	if len(addrs) == 0 {
+		addrs = []string{net.JoinHostPort(a.Host, strconv.FormatUint(uint64(a.Port), 10))}
+	}
+	addrs, err = resolveAddrs(addrs)
+	if err != nil {
+		return nil, err
+	}
 
-	svr := newUnstartedServer(addr, healthz())
+	svr, err := newUnstartedServer(addrs, healthz())
+	if err != nil {
+		return nil, err
+	}
+	svr.EnableHTTP2 = a.HTTP2
+	svr.EnableH2C = a.H2C
+	svr.MaxConns = a.MaxConnections
+	a.limit(svr.Config)
 	a.Svr = svr
 
-	c, err := swagger.NewContainer(svr.URL, a.SwaggerDir, info, ws...)
+	c, docs, err := swagger.NewContainerWithDocs("", a.SwaggerDir, info, ws...)
 	if err != nil {
+		svr.closeListeners()
 		return nil, err
 	}
 	svr.Config.Handler = c
 	a.Container = c
+	a.docs = docs
+	c.Filter(limitBody(a.MaxRequestBodyBytes, bodyLimits(c)))
+
+	if a.AdminHost != "" {
+		adminAddrs, err := resolveAddrs([]string{net.JoinHostPort(a.AdminHost, strconv.FormatUint(uint64(a.AdminPort), 10))})
+		if err == nil {
+			a.adminMux = http.NewServeMux()
+			a.AdminSvr, err = newUnstartedServer(adminAddrs, a.adminMux)
+		}
+		if err != nil {
+			svr.closeListeners()
+			return nil, err
+		}
+		a.limit(a.AdminSvr.Config)
+		handlePprof(a.adminMux)
+		a.adminMux.Handle(LogLevelPath, logLevel())
+	}
+	if err := checkInheritedUsed(); err != nil {
+		svr.closeListeners()
+		if a.AdminSvr != nil {
+			a.AdminSvr.closeListeners()
+		}
+		return nil, err
+	}
 
-	c.Handle(HealthzPath, healthz())
-	c.Handle(HomePath, home(a))
+	a.HandleAdmin(HealthzPath, healthz())
+	a.HandleAdmin(HomePath, home(&a))
+	a.HandleAdmin(MetricsPath, promhttp.Handler())
+	a.HandleAdmin(ReloadPath, reloadStatus(&a))
+	a.HandleAdmin(InfoPath, infoHandler(&a))
 
 	a.isReady = &atomic.Value{}
-	c.Handle(ReadyzPath, readyz(a.isReady))
+	a.HandleAdmin(ReadyzPath, readyz(a.isReady))
 
 	return &a, nil
 
 }
 
-//Start starts a server and return immediately
-func (a *Instance) Start() {
+//limit applies the timeouts and the header limit to s
+func (a *Instance) limit(s *http.Server) {
+	s.ReadHeaderTimeout = a.ReadHeaderTimeout
+	s.ReadTimeout = a.ReadTimeout
+	s.WriteTimeout = a.WriteTimeout
+	s.IdleTimeout = a.IdleTimeout
+	s.MaxHeaderBytes = a.MaxHeaderBytes
+}
 
-	a.Svr.Start()
-	a.isReady.Store(true)
-	log.Infof("server %s is ready to serve", a.Svr.URL)
+//AddStatus shows the value returned by fn under name on the home page, to the requests on the
+//admin listener or carrying the ADMIN_TOKEN. It must be called before Start
+func (a *Instance) AddStatus(name string, fn func() interface{}) {
+	a.statuses = append(a.statuses, status{name: name, fn: fn})
+}
+
+//AddComponent registers c to be started with the server and stopped after it
+func (a *Instance) AddComponent(c Component) {
+	a.components = append(a.components, c)
+}
 
+//OnShutdown registers fn to run as Close starts, before the servers drain their requests,
+//e.g. to give up a leadership at once rather than once the last request is done.
+//The functions run in reverse order of registration
+func (a *Instance) OnShutdown(fn func(ctx context.Context) error) {
+	a.onShutdown = append(a.onShutdown, fn)
 }
 
-//Close ends a server execution
+//SetHTTP3 sets the server of HTTP/3, which is served when HTTP3 is set. It must be called before Start
+func (a *Instance) SetHTTP3(s HTTP3Server) {
+	a.http3 = s
+}
+
+//Start starts the admin server, the components and the server and return immediately.
+//The admin server answers probes while the components start
+func (a *Instance) Start() error {
+
+	if a.HTTP3 {
+		if a.http3 == nil {
+			a.Svr.closeListeners()
+			if a.AdminSvr != nil {
+				a.AdminSvr.closeListeners()
+			}
+			return errors.New("HTTP3 is set but there is no HTTP3Server, see SetHTTP3")
+		}
+		a.Svr.HTTP3 = a.http3
+	}
+
+	if a.AdminSvr != nil {
+		a.AdminSvr.Start()
+		log.Infof("admin server %s is serving", strings.Join(a.AdminSvr.URLs, ", "))
+	}
+
+	for i, c := range a.components {
+		if err := c.Start(); err != nil {
+			a.stopComponents(a.components[:i])
+			if a.AdminSvr != nil {
+				a.AdminSvr.Close()
+			}
+			a.Svr.closeListeners()
+			return fmt.Errorf("starting component %T: %w", c, err)
+		}
+	}
+
+	if a.TLSCertFile != "" {
+		if err := a.Svr.StartTLS(a.TLSCertFile, a.TLSKeyFile); err != nil {
+			a.stopComponents(a.components)
+			if a.AdminSvr != nil {
+				a.AdminSvr.Close()
+			}
+			a.Svr.closeListeners()
+			return err
+		}
+	} else {
+		a.Svr.Start()
+	}
+	a.isReady.Store(true)
+	log.Infof("server %s is ready to serve", strings.Join(a.Svr.URLs, ", "))
+	notifyUpgradeReady()
+	return nil
+}
+
+//Close runs the OnShutdown functions, ends a server execution, then stops the components
+//and the admin server
 func (a *Instance) Close() {
+	a.isReady.Store(false)
+	a.shutdownHooks()
 	a.Svr.Close()
-	log.Infof("server %s shut down. exit.", a.Svr.URL)
+	a.stopComponents(a.components)
+	if a.AdminSvr != nil {
+		a.AdminSvr.Close()
+	}
+	log.Infof("server %s shut down. exit.", strings.Join(a.Svr.URLs, ", "))
+}
+
+//shutdownHooks runs the OnShutdown functions in reverse order of registration
+func (a *Instance) shutdownHooks() {
+	ctx, cancel := a.shutdownContext()
+	defer cancel()
+
+	for i := len(a.onShutdown) - 1; i >= 0; i-- {
+		if err := a.onShutdown[i](ctx); err != nil {
+			log.Errorf("shutdown hook: %v", err)
+		}
+	}
+}
+
+//stopComponents stops components in reverse order of start
+func (a *Instance) stopComponents(components []Component) {
+	ctx, cancel := a.shutdownContext()
+	defer cancel()
+
+	for i := len(components) - 1; i >= 0; i-- {
+		if err := components[i].Stop(ctx); err != nil {
+			log.Errorf("stopping component %T: %v", components[i], err)
+		}
+	}
+}
+
+//shutdownContext bounds a step of Close by ShutdownTimeout
+func (a *Instance) shutdownContext() (context.Context, context.CancelFunc) {
+	timeout := a.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
 }
 
 //Run starts a server and keep running until either it gets a SIGINTR or ctx is Done.
+//A SIGHUP reloads the configuration, see SetReloader. A SIGUSR2 upgrades the server, see Upgrade
 func (a *Instance) Run(ctx context.Context) {
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
+	defer signal.Stop(upgrade)
+
+	if err := a.Start(); err != nil {
+		log.Errorf("app start: %v", err)
+		return
+	}
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	a.watchConfig(watchCtx)
 
-	a.Start()
-	//TODO detect signals.
-	select {
-	case <-ctx.Done():
-		log.Infof("app get done signal. shutting down http server ...")
-	case <-interrupt:
-		log.Infof("Got SIGINT or SIGTERM, shutting down http server ...")
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("app get done signal. shutting down http server ...")
+			break loop
+		case <-interrupt:
+			log.Infof("Got SIGINT or SIGTERM, shutting down http server ...")
+			break loop
+		case <-hangup:
+			if _, ok := a.Reload("SIGHUP"); !ok {
+				log.Warnf("Got SIGHUP, but configuration reload is not set up")
+			}
+		case <-upgrade:
+			log.Infof("Got SIGUSR2, upgrading ...")
+			if err := a.Upgrade(); err != nil {
+				log.Errorf("upgrade failed, still serving: %v", err)
+				continue
+			}
+			log.Infof("upgraded, draining the connections of this process ...")
+			break loop
+		}
 	}
-	log.Infof("server %s is shutting down ...", a.Svr.URL)
+	stopWatch()
+	log.Infof("server %s is shutting down ...", strings.Join(a.Svr.URLs, ", "))
 	a.Close()
 }
@@ -8,7 +8,7 @@ import (
 	restfulspec "github.com/emicklei/go-restful-openapi"
 	"github.com/jusongchen/REST-app/pkg/rest/middleware"
 	"github.com/jusongchen/REST-app/pkg/rest/swagger"
-	"github.com/kelseyhightower/envconfig"
+	"github.com/sethvargo/go-envconfig"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -23,7 +23,7 @@ func Example() {
 	}
 
 	cfg := Config{}
-	err := envconfig.Process("", &cfg)
+	err := envconfig.Process(context.Background(), &cfg)
 	if err != nil {
 		log.Errorf("envconfig:%v", err)
 	}
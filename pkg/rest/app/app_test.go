@@ -1,13 +1,23 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/jusongchen/REST-app/pkg/config"
+	"github.com/jusongchen/REST-app/pkg/logging"
 	"github.com/jusongchen/REST-app/pkg/rest/swagger"
-	"github.com/kelseyhightower/envconfig"
+	"github.com/sethvargo/go-envconfig"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestApp_Run(t *testing.T) {
@@ -72,7 +82,7 @@ func TestApp_Run(t *testing.T) {
 			}
 
 			spec := Config{}
-			err := envconfig.Process("", &spec)
+			err := envconfig.Process(context.Background(), &spec)
 			require.NoError(t, err)
 
 			u := UserResource{map[string]User{}}
@@ -87,12 +97,13 @@ func TestApp_Run(t *testing.T) {
 
 			a.Start()
 			defer a.Close()
-			baseURL := a.Svr.URL
+			baseURL := a.Svr.URLs[0]
 
 			paths := []string{
 				ReadyzPath,
 				HealthzPath,
 				HomePath,
+				MetricsPath,
 				userResourceRootPath,
 			}
 			for _, p := range paths {
@@ -105,3 +116,137 @@ func TestApp_Run(t *testing.T) {
 		})
 	}
 }
+
+// recorder is a Component recording its calls in events.
+type recorder struct {
+	name     string
+	events   *[]string
+	startErr error
+}
+
+func (r recorder) Start() error {
+	*r.events = append(*r.events, "start "+r.name)
+	return r.startErr
+}
+
+func (r recorder) Stop(ctx context.Context) error {
+	*r.events = append(*r.events, "stop "+r.name)
+	return nil
+}
+
+func TestApp_Components(t *testing.T) {
+	conf := Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1"}
+
+	var events []string
+	a, err := New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	a.AddComponent(recorder{name: "a", events: &events})
+	a.AddComponent(recorder{name: "b", events: &events})
+	a.OnShutdown(func(ctx context.Context) error {
+		resp, err := http.Get(a.Svr.URLs[0] + HealthzPath)
+		if err == nil {
+			resp.Body.Close()
+			events = append(events, "shutdown, still serving")
+		}
+		return err
+	})
+
+	require.NoError(t, a.Start())
+	a.Close()
+	require.Equal(t, []string{"start a", "start b", "shutdown, still serving", "stop b", "stop a"}, events)
+
+	events = nil
+	a, err = New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	a.AddComponent(recorder{name: "a", events: &events})
+	a.AddComponent(recorder{name: "b", events: &events, startErr: errors.New("boom")})
+	a.AddComponent(recorder{name: "c", events: &events})
+
+	require.Error(t, a.Start())
+	require.Equal(t, []string{"start a", "start b", "stop a"}, events)
+	l, err := net.Listen("tcp", a.Svr.Listeners[0].Addr().String())
+	require.NoError(t, err, "the port is free again")
+	l.Close()
+}
+
+type reloaderFunc func(ctx context.Context) ReloadResult
+
+func (f reloaderFunc) Reload(ctx context.Context) ReloadResult { return f(ctx) }
+
+func TestApp_Reload(t *testing.T) {
+	a, err := New(Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1"}, swagger.ServerInfo{})
+	require.NoError(t, err)
+
+	_, ok := a.Reload("test")
+	require.False(t, ok)
+
+	reloaded := make(chan struct{}, 1)
+	a.SetReloader(reloaderFunc(func(ctx context.Context) ReloadResult {
+		reloaded <- struct{}{}
+		return ReloadResult{Rejected: []config.Change{{Key: "PORT", Old: "80", New: "8080"}}}
+	}), "")
+
+	rec := httptest.NewRecorder()
+	a.Container.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReloadPath, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return a.isReady.Load() == true }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP did not reload the configuration")
+	}
+	cancel()
+	<-done
+
+	rec = httptest.NewRecorder()
+	a.Container.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReloadPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var res ReloadResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Equal(t, "SIGHUP", res.Trigger)
+	require.Equal(t, "PORT", res.Rejected[0].Key)
+}
+
+func TestApp_AdminListener(t *testing.T) {
+	conf := Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", AdminHost: "127.0.0.1"}
+	a, err := New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	require.NotNil(t, a.AdminSvr)
+	require.NoError(t, a.Start())
+	defer a.Close()
+	defer logging.SetDefaultLevel("INFO")
+
+	status := func(method, url string) int {
+		req, err := http.NewRequest(method, url, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, p := range []string{HealthzPath, ReadyzPath, MetricsPath, HomePath, InfoPath, PprofPath, LogLevelPath} {
+		require.Equal(t, http.StatusOK, status(http.MethodGet, a.AdminSvr.URLs[0]+p), p)
+		require.Equal(t, http.StatusNotFound, status(http.MethodGet, a.Svr.URLs[0]+p), p)
+	}
+	require.Equal(t, http.StatusOK, status(http.MethodGet, a.Svr.URLs[0]+swaggerUIHomeURL))
+
+	require.Equal(t, http.StatusOK, status(http.MethodPut, a.AdminSvr.URLs[0]+LogLevelPath+"?level=debug"))
+	require.Equal(t, zapcore.DebugLevel, logging.GetDefaultLogLevel())
+	require.Equal(t, http.StatusBadRequest, status(http.MethodPut, a.AdminSvr.URLs[0]+LogLevelPath+"?level=loud"))
+}
+
+func TestConfig_ValidateAdmin(t *testing.T) {
+	conf := Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", Port: 8080, AdminHost: "admin host", AdminPort: 8080}
+	var errs config.Errors
+	require.ErrorAs(t, conf.Validate(), &errs)
+	require.Len(t, errs, 2)
+}
@@ -8,23 +8,42 @@ import (
 	"time"
 )
 
-// home returns a simple HTTP handler function which writes a response.
-func home(a Instance) http.HandlerFunc {
+// home returns a simple HTTP handler function which writes a response. The statuses
+// and the listener URLs are shown to trusted requests only, see Instance.trusted.
+func home(a *Instance) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		trusted := a.trusted(r)
+
+		var statuses map[string]interface{}
+		if trusted && len(a.statuses) > 0 {
+			statuses = map[string]interface{}{}
+			for _, s := range a.statuses {
+				statuses[s.name] = s.fn()
+			}
+		}
+
+		var urls []string
+		if trusted && a.Svr != nil {
+			urls = a.Svr.URLs
+		}
 
 		info := struct {
 			UpTime      string `json:"up_time,omitempty"`
 			StartupTime time.Time
 			Host        string
 			Port        uint
+			URLs        []string `json:",omitempty"`
 			SwaggerDir  string
+			Status      map[string]interface{} `json:",omitempty"`
 		}{
 
 			time.Now().Sub(a.StartupTime).String(),
 			a.StartupTime,
 			a.Config.Host,
 			a.Config.Port,
+			urls,
 			a.Config.SwaggerDir,
+			statuses,
 		}
 
 		data, err := json.MarshalIndent(info, "", "  ")
@@ -35,6 +54,6 @@ func home(a Instance) http.HandlerFunc {
 		}
 		w.Header().Set("Content-Type", "text/plain")
 
-		io.WriteString(w, string(data)+"\n"+a.Config.About)
+		io.WriteString(w, string(data)+"\n")
 	}
 }
@@ -1,15 +1,31 @@
 package app
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 
+	"github.com/jusongchen/REST-app/pkg/config"
 	"github.com/stretchr/testify/require"
 )
 
 func TestHandlerHome(t *testing.T) {
 
-	require.HTTPSuccess(t, home(Instance{}), "GET", HomePath, nil)
+	require.HTTPSuccess(t, home(&Instance{}), "GET", HomePath, nil)
+
+	a := &Instance{Config: Config{AdminToken: "s3cret"}}
+	a.AddStatus("leader_election", func() interface{} { return map[string]bool{"is_leader": true} })
+	require.HTTPBodyNotContains(t, home(a), "GET", HomePath, nil, "is_leader", "statuses are not public")
+
+	req := httptest.NewRequest(http.MethodGet, HomePath, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	home(a)(rec, req)
+	require.Contains(t, rec.Body.String(), `"is_leader": true`)
+
+	a.adminMux = http.NewServeMux()
+	require.HTTPBodyContains(t, home(a), "GET", HomePath, nil, `"is_leader": true`, "the admin listener is trusted")
 
 }
 
@@ -26,3 +42,43 @@ func TestHealthz(t *testing.T) {
 
 	require.HTTPBodyContains(t, healthz(), "GET", HealthzPath, nil, "alive")
 }
+
+func TestInfo(t *testing.T) {
+	a := &Instance{Config: Config{AdminToken: "s3cret"}}
+	a.SetInfo(ReadBuildInfo("1.0.0", "abc", "today"), func() []config.Setting {
+		return []config.Setting{{Key: "DB_PASSWORD", Value: "********", Secret: true}}
+	})
+	a.build.Deps = []Module{{Path: "example.com/dep", Version: "v1.0.0"}}
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, InfoPath, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		infoHandler(a)(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"release": "1.0.0"`)
+	require.Contains(t, rec.Body.String(), `"go_version"`)
+	require.NotContains(t, rec.Body.String(), "example.com/dep")
+	require.NotContains(t, rec.Body.String(), "DB_PASSWORD")
+
+	require.Equal(t, http.StatusUnauthorized, get("Bearer wrong").Code)
+
+	rec = get("Bearer s3cret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "example.com/dep")
+	require.Contains(t, rec.Body.String(), `"DB_PASSWORD"`)
+
+	a.AdminToken = ""
+	require.Equal(t, http.StatusUnauthorized, get("Bearer ").Code)
+
+	a.adminMux = http.NewServeMux()
+	rec = get("Basic dXNlcjpwYXNz")
+	require.Equal(t, http.StatusOK, rec.Code, "the admin listener is trusted, whatever the credentials")
+	require.Contains(t, rec.Body.String(), `"DB_PASSWORD"`)
+}
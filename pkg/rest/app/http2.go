@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP3Server serves HTTP/3 over QUIC. None is built in: adapt one, e.g.
+// the http3.Server of github.com/quic-go/quic-go, whose Serve takes the
+// config and handler as its TLSConfig and Handler, and pass it to
+// Instance.SetHTTP3.
+type HTTP3Server interface {
+	// Serve serves handler with config on the UDP socket conn until Close
+	// is called.
+	Serve(conn net.PacketConn, config *tls.Config, handler http.Handler) error
+	// Close stops serving.
+	Close() error
+}
+
+// configureHTTP2 enables HTTP/2 on s, on plain connections if h2c is set.
+func (s *Server) configureHTTP2(cleartext bool) {
+	h2s := &http2.Server{}
+	// ConfigureServer registers h2s to be shut down with s.Config, see
+	// shutdownHTTP2, which also covers the h2c connections h2s serves.
+	if err := http2.ConfigureServer(s.Config, h2s); err != nil {
+		panic(fmt.Sprintf("httpsvr: configuring HTTP/2: %v", err))
+	}
+	if cleartext {
+		s.Config.Handler = s.trackH2C(h2c.NewHandler(s.Config.Handler, h2s))
+	}
+	s.http2 = true
+}
+
+// trackH2C makes Close wait for the h2c connections handled by h: they are
+// hijacked from net/http, and served until the handler returns.
+func (s *Server) trackH2C(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isH2C(r) {
+			s.wg.Add(1)
+			defer s.wg.Done()
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isH2C reports whether r starts an h2c connection, with prior knowledge or
+// by upgrade.
+func isH2C(r *http.Request) bool {
+	if r.Method == "PRI" && r.URL.Path == "*" && r.Proto == "HTTP/2.0" {
+		return true
+	}
+	for _, v := range r.Header.Values("Upgrade") {
+		if strings.EqualFold(strings.TrimSpace(v), "h2c") {
+			return true
+		}
+	}
+	return false
+}
+
+// shutdownHTTP2 sends a GOAWAY on the HTTP/2 connections. http.Server runs
+// the HTTP/2 shutdown hook only from Shutdown, which is called with a done
+// context so that it does not wait: Close does.
+func (s *Server) shutdownHTTP2() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Config.Shutdown(ctx)
+}
+
+// startHTTP3 serves HTTP/3 on the UDP port of the first TCP listener and
+// advertises that port on the TCP responses as long as HTTP/3 is served.
+func (s *Server) startHTTP3() error {
+	var tcp *net.TCPAddr
+	for _, l := range s.Listeners {
+		if a, ok := l.Addr().(*net.TCPAddr); ok {
+			tcp = a
+			break
+		}
+	}
+	if tcp == nil {
+		return errors.New("httpsvr: HTTP/3 needs a TCP listener to share its port")
+	}
+	conn, err := net.ListenPacket("udp", tcp.String())
+	if err != nil {
+		return fmt.Errorf("httpsvr: listening for HTTP/3: %w", err)
+	}
+
+	config := s.TLS.Clone()
+	config.NextProtos = []string{"h3"}
+	handler := s.Config.Handler
+
+	serving := int32(1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer conn.Close()
+		err := s.HTTP3.Serve(conn, config, handler)
+		atomic.StoreInt32(&serving, 0)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("httpsvr: HTTP/3 server: %v", err)
+		}
+	}()
+
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, tcp.Port)
+	s.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&serving) == 1 {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return nil
+}
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/rest/swagger"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+//writeCert writes a self-signed certificate for 127.0.0.1 and its key
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+//protoHandler answers with the protocol of the request
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Proto))
+})
+
+//newTestServer returns an unstarted server on a loopback port
+func newTestServer(t *testing.T, handler http.Handler) *Server {
+	t.Helper()
+	s, err := newUnstartedServer([]string{"127.0.0.1:0"}, handler)
+	require.NoError(t, err)
+	return s
+}
+
+//requireClosesQuickly fails if s does not close within a few seconds
+func requireClosesQuickly(t *testing.T, s *Server) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(4 * time.Second):
+		t.Fatal("server did not close")
+	}
+}
+
+func TestServer_H2C(t *testing.T) {
+	s := newTestServer(t, protoHandler)
+	s.EnableH2C = true
+	s.Start()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	resp, err := client.Get(s.URLs[0])
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 2, resp.ProtoMajor)
+
+	resp, err = http.Get(s.URLs[0])
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, resp.ProtoMajor, "HTTP/1.1 still served")
+
+	requireClosesQuickly(t, s)
+}
+
+func TestServer_HTTP2OverTLS(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	for _, enabled := range []bool{true, false} {
+		s := newTestServer(t, protoHandler)
+		s.EnableHTTP2 = enabled
+		require.NoError(t, s.StartTLS(certFile, keyFile))
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get(s.URLs[0])
+		require.NoError(t, err)
+		resp.Body.Close()
+		if enabled {
+			require.Equal(t, 2, resp.ProtoMajor)
+		} else {
+			require.Equal(t, 1, resp.ProtoMajor)
+		}
+		requireClosesQuickly(t, s)
+		client.CloseIdleConnections()
+	}
+
+	s := newTestServer(t, protoHandler)
+	require.Error(t, s.StartTLS(keyFile, certFile))
+	s.Close()
+}
+
+//fakeHTTP3 records how it is served and blocks until closed, or fails with err
+type fakeHTTP3 struct {
+	mu     sync.Mutex
+	addr   string
+	protos []string
+	err    error
+	closed chan struct{}
+}
+
+func (f *fakeHTTP3) Serve(conn net.PacketConn, config *tls.Config, handler http.Handler) error {
+	f.mu.Lock()
+	f.addr, f.protos = conn.LocalAddr().String(), config.NextProtos
+	f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	<-f.closed
+	return http.ErrServerClosed
+}
+
+func (f *fakeHTTP3) Close() error {
+	close(f.closed)
+	return nil
+}
+
+func TestServer_HTTP3(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	h3 := &fakeHTTP3{closed: make(chan struct{})}
+	s := newTestServer(t, protoHandler)
+	s.HTTP3 = h3
+	require.NoError(t, s.StartTLS(certFile, keyFile))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(s.URLs[0])
+	require.NoError(t, err)
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(s.Listeners[0].Addr().String())
+	require.Equal(t, `h3=":`+port+`"; ma=86400`, resp.Header.Get("Alt-Svc"))
+
+	requireClosesQuickly(t, s)
+	h3.mu.Lock()
+	defer h3.mu.Unlock()
+	require.Equal(t, s.Listeners[0].Addr().String(), h3.addr)
+	require.Equal(t, []string{"h3"}, h3.protos)
+}
+
+func TestServer_HTTP3_FirstTCPListener(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	dir, err := ioutil.TempDir("", "sock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sock := "unix://" + filepath.Join(dir, "app.sock")
+
+	s, err := newUnstartedServer([]string{sock}, protoHandler)
+	require.NoError(t, err)
+	s.HTTP3 = &fakeHTTP3{closed: make(chan struct{})}
+	require.Error(t, s.StartTLS(certFile, keyFile), "no TCP listener")
+	s.closeListeners()
+
+	h3 := &fakeHTTP3{closed: make(chan struct{})}
+	s, err = newUnstartedServer([]string{sock, "127.0.0.1:0"}, protoHandler)
+	require.NoError(t, err)
+	s.HTTP3 = h3
+	require.NoError(t, s.StartTLS(certFile, keyFile))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(s.URLs[1])
+	require.NoError(t, err)
+	resp.Body.Close()
+	tcp := s.Listeners[1].Addr().(*net.TCPAddr)
+	require.Equal(t, fmt.Sprintf(`h3=":%d"; ma=86400`, tcp.Port), resp.Header.Get("Alt-Svc"))
+
+	requireClosesQuickly(t, s)
+	h3.mu.Lock()
+	defer h3.mu.Unlock()
+	require.Equal(t, tcp.String(), h3.addr)
+}
+
+func TestServer_HTTP3_Failed(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	// The UDP port is taken: StartTLS fails rather than advertise it.
+	s := newTestServer(t, protoHandler)
+	tcp := s.Listeners[0].Addr().(*net.TCPAddr)
+	udp, err := net.ListenPacket("udp", tcp.String())
+	require.NoError(t, err)
+	defer udp.Close()
+	s.HTTP3 = &fakeHTTP3{closed: make(chan struct{})}
+	require.Error(t, s.StartTLS(certFile, keyFile))
+	s.closeListeners()
+
+	// HTTP/3 stopped serving: it is no longer advertised.
+	s = newTestServer(t, protoHandler)
+	s.HTTP3 = &fakeHTTP3{err: errors.New("quic: no luck"), closed: make(chan struct{})}
+	require.NoError(t, s.StartTLS(certFile, keyFile))
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(s.URLs[0])
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Alt-Svc") == ""
+	}, time.Second, 10*time.Millisecond)
+	requireClosesQuickly(t, s)
+	client.CloseIdleConnections()
+}
+
+func TestConfig_ValidateProtocols(t *testing.T) {
+	conf := Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", TLSCertFile: "cert.pem", H2C: true}
+	require.Error(t, conf.Validate())
+
+	conf = Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", HTTP3: true}
+	require.Error(t, conf.Validate())
+
+	a, err := New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	require.Error(t, a.Start(), "HTTP3 without an HTTP3Server")
+	a.Svr.Close()
+}
@@ -15,9 +15,11 @@ import (
 
 // A Server is an HTTP server listening on a system-chosen port on the
 // local loopback interface, for use in end-to-end HTTP tests.
+//
+// It serves the same handler on each of its listeners.
 type Server struct {
-	URL      string // base URL of form http://ipaddr:port with no trailing slash
-	Listener net.Listener
+	URLs      []string // base URLs of form http://ipaddr:port, or unix:///path for a unix socket, with no trailing slash, one per listener
+	Listeners []net.Listener
 
 	// TLS is the optional TLS configuration, populated with a new config
 	// after TLS is started. If set on an unstarted server before StartTLS
@@ -28,6 +30,30 @@ type Server struct {
 	// before start or StartTLS.
 	Config *http.Server
 
+	// EnableHTTP2 controls whether HTTP/2 is enabled on the server after
+	// StartTLS. EnableH2C enables HTTP/2 without TLS after Start. They must
+	// be set between calling newUnstartedServer and calling Start or StartTLS.
+	EnableHTTP2 bool
+	EnableH2C   bool
+
+	// MaxConns, if positive, bounds the open connections of all the
+	// listeners: the ones accepted beyond are closed. It must be set before
+	// Start or StartTLS.
+	MaxConns int
+
+	// HTTP3, if set, serves HTTP/3 on the UDP port of the first listener
+	// after StartTLS, which is then advertised by an Alt-Svc header.
+	HTTP3 HTTP3Server
+
+	// addrs are the addresses the server was created with, and raw their
+	// listeners before any wrapping, handed over to a new process by Upgrade.
+	addrs []string
+	raw   []net.Listener
+
+	// http2 is set once HTTP/2 is configured, Close then shuts its
+	// connections down gracefully.
+	http2 bool
+
 	// wg counts the number of outstanding HTTP requests on this server.
 	// Close blocks until all requests are finished.
 	wg sync.WaitGroup
@@ -38,29 +64,32 @@ type Server struct {
 
 }
 
-func newLocalListener(addr string) net.Listener {
+func newLocalListener(addr string) (net.Listener, error) {
 	if addr != "" {
-		l, err := net.Listen("tcp", addr)
+		l, err := listen(addr)
 		if err != nil {
-			panic(fmt.Sprintf("httpsvr: failed to listen on %v: %v", addr, err))
+			return nil, fmt.Errorf("httpsvr: failed to listen on %v: %w", addr, err)
 		}
-		return l
+		return l, nil
 	}
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
-			panic(fmt.Sprintf("httpsvr: failed to listen on a port: %v", err))
+			return nil, fmt.Errorf("httpsvr: failed to listen on a port: %w", err)
 		}
 	}
-	return l
+	return l, nil
 }
 
 // NewServer starts and returns a new Server.
 // The caller should call Close when finished, to shut it down.
-func newServer(addr string, handler http.Handler) *Server {
-	ts := newUnstartedServer(addr, handler)
+func newServer(addrs []string, handler http.Handler) (*Server, error) {
+	ts, err := newUnstartedServer(addrs, handler)
+	if err != nil {
+		return nil, err
+	}
 	ts.Start()
-	return ts
+	return ts, nil
 }
 
 // newUnstartedServer returns a new Server but doesn't start it.
@@ -69,26 +98,132 @@ func newServer(addr string, handler http.Handler) *Server {
 // StartTLS.
 //
 // The caller should call Close when finished, to shut it down.
-func newUnstartedServer(addr string, handler http.Handler) *Server {
-	return &Server{
-		Listener: newLocalListener(addr),
-		Config:   &http.Server{Handler: handler},
+//
+// addrs are host:port or listener URLs, see listen, the server gets a
+// listener for each, or the ones handed over by an upgrade, see Upgrade.
+func newUnstartedServer(addrs []string, handler http.Handler) (*Server, error) {
+	s := &Server{
+		Config: &http.Server{Handler: handler},
+		addrs:  addrs,
+	}
+	if ls, ok, err := inheritedListeners(addrs); ok {
+		if err != nil {
+			return nil, err
+		}
+		s.Listeners = ls
+		s.raw = append([]net.Listener(nil), ls...)
+		return s, nil
+	}
+	for _, addr := range addrs {
+		l, err := newLocalListener(addr)
+		if err != nil {
+			s.closeListeners()
+			return nil, err
+		}
+		s.Listeners = append(s.Listeners, l)
+		s.raw = append(s.raw, l)
+	}
+	return s, nil
+}
+
+// closeListeners closes the listeners of a server which is not started.
+func (s *Server) closeListeners() {
+	for _, l := range s.Listeners {
+		l.Close()
 	}
 }
 
 // Start starts a server from newUnstartedServer.
 func (s *Server) Start() {
-	if s.URL != "" {
+	if len(s.URLs) > 0 {
 		panic("Server already started")
 	}
 
-	s.URL = "http://" + s.Listener.Addr().String()
+	if s.EnableH2C {
+		s.configureHTTP2(true)
+	}
+	s.limitListeners()
+	s.setURLs("http")
 	s.wrap()
 	s.goServe()
-	// fmt.Fprintln(os.Stderr, "httpsvr: serving on", s.URL)
+	// fmt.Fprintln(os.Stderr, "httpsvr: serving on", s.URLs)
 	// select {}
 }
 
+// StartTLS starts TLS on a server from newUnstartedServer, with the
+// certificate and key of certFile and keyFile.
+func (s *Server) StartTLS(certFile, keyFile string) error {
+	if len(s.URLs) > 0 {
+		panic("Server already started")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("httpsvr: loading TLS certificate: %w", err)
+	}
+
+	existingConfig := s.TLS
+	if existingConfig != nil {
+		s.TLS = existingConfig.Clone()
+	} else {
+		s.TLS = new(tls.Config)
+	}
+	if s.TLS.NextProtos == nil {
+		nextProtos := []string{"http/1.1"}
+		if s.EnableHTTP2 {
+			nextProtos = []string{"h2", "http/1.1"}
+		}
+		s.TLS.NextProtos = nextProtos
+	}
+	s.TLS.Certificates = append(s.TLS.Certificates, cert)
+	if s.EnableHTTP2 {
+		s.configureHTTP2(false)
+	} else {
+		// A non-nil empty map keeps net/http from enabling HTTP/2.
+		s.Config.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	if s.HTTP3 != nil {
+		if err := s.startHTTP3(); err != nil {
+			return err
+		}
+	}
+
+	s.limitListeners()
+	for i, l := range s.Listeners {
+		s.Listeners[i] = tls.NewListener(l, s.TLS)
+	}
+	s.setURLs("https")
+	s.wrap()
+	s.goServe()
+	return nil
+}
+
+// limitListeners bounds the open connections of all the listeners together
+// to MaxConns.
+func (s *Server) limitListeners() {
+	if s.MaxConns <= 0 {
+		return
+	}
+	sem := make(chan struct{}, s.MaxConns)
+	for i, l := range s.Listeners {
+		s.Listeners[i] = newLimitListener(l, sem)
+	}
+}
+
+// setURLs sets the URLs of the listeners, served with scheme.
+func (s *Server) setURLs(scheme string) {
+	for _, l := range s.Listeners {
+		s.URLs = append(s.URLs, baseURL(scheme, l.Addr()))
+	}
+}
+
+// baseURL returns the URL of a server with scheme listening on addr.
+func baseURL(scheme string, addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return "unix://" + addr.String()
+	}
+	return scheme + "://" + addr.String()
+}
+
 type closeIdleTransport interface {
 	CloseIdleConnections()
 }
@@ -99,7 +234,9 @@ func (s *Server) Close() {
 	s.mu.Lock()
 	if !s.closed {
 		s.closed = true
-		s.Listener.Close()
+		for _, l := range s.Listeners {
+			l.Close()
+		}
 		s.Config.SetKeepAlivesEnabled(false)
 		for c, st := range s.conns {
 			// Force-close any idle connections (those between
@@ -130,6 +267,18 @@ func (s *Server) Close() {
 	}
 	s.mu.Unlock()
 
+	// HTTP/2 connections stay active as long as they carry streams, and
+	// h2c ones are hijacked from net/http: ask their clients to go away,
+	// the connections close once their streams are done.
+	if s.http2 {
+		s.shutdownHTTP2()
+	}
+	if s.HTTP3 != nil {
+		if err := s.HTTP3.Close(); err != nil {
+			log.Printf("httpsvr: closing HTTP/3 server: %v", err)
+		}
+	}
+
 	// Not part of httpsvr.Server's correctness, but assume most
 	// users of httpsvr.Server will be using the standard
 	// transport, so help them out and close any idle connections for them.
@@ -180,11 +329,13 @@ func (s *Server) closeClientConnections() {
 }
 
 func (s *Server) goServe() {
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		s.Config.Serve(s.Listener)
-	}()
+	for _, l := range s.Listeners {
+		s.wg.Add(1)
+		go func(l net.Listener) {
+			defer s.wg.Done()
+			s.Config.Serve(l)
+		}(l)
+	}
 }
 
 // wrap installs the connection state-tracking hook to know which
@@ -213,7 +364,9 @@ func (s *Server) wrap() {
 			}
 		case http.StateActive:
 			if oldState, ok := s.conns[c]; ok {
-				if oldState != http.StateNew && oldState != http.StateIdle {
+				// An HTTP/2 connection reports active again when net/http
+				// hands it over to the HTTP/2 server.
+				if oldState != http.StateNew && oldState != http.StateIdle && oldState != http.StateActive {
 					panic("invalid state transition")
 				}
 				s.conns[c] = cs
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/config"
+)
+
+//BuildInfo identifies the running binary
+type BuildInfo struct {
+	Release   string `json:"release"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	//Path is the main module of the binary
+	Path string `json:"path,omitempty"`
+	//Deps are the modules built into the binary, only shown to trusted requests
+	Deps []Module `json:"deps,omitempty"`
+}
+
+//Module is a dependency built into the binary
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+//ReadBuildInfo completes the version stamped at link time with what the Go toolchain recorded in the binary
+func ReadBuildInfo(release, commit, buildTime string) BuildInfo {
+	b := BuildInfo{Release: release, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Path = bi.Main.Path
+	for _, d := range bi.Deps {
+		m := Module{Path: d.Path, Version: d.Version}
+		if d.Replace != nil {
+			m.Replace = d.Replace.Path + " " + d.Replace.Version
+		}
+		b.Deps = append(b.Deps, m)
+	}
+	return b
+}
+
+//info is the body of InfoPath
+type info struct {
+	Build       BuildInfo `json:"build"`
+	StartupTime time.Time `json:"startup_time"`
+	UpTime      string    `json:"up_time"`
+	//Config lists the settings, secrets masked, only shown to trusted requests
+	Config []config.Setting `json:"config,omitempty"`
+}
+
+//SetInfo sets what InfoPath serves: build about the binary and, to trusted requests only,
+//its dependencies and the settings returned by settings, see config.InfoSettings.
+//It must be called before Start
+func (a *Instance) SetInfo(build BuildInfo, settings func() []config.Setting) {
+	a.build = build
+	a.settings = settings
+}
+
+//isAdmin reports whether r carries the ADMIN_TOKEN as a bearer token
+func (a *Instance) isAdmin(r *http.Request) bool {
+	if a.AdminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) == 1
+}
+
+//trusted reports whether r may see the runtime state of the server: it came in on the
+//admin listener, not to be exposed through the public ingress, or it is an admin request
+func (a *Instance) trusted(r *http.Request) bool {
+	return a.adminMux != nil || a.isAdmin(r)
+}
+
+//infoHandler serves the build of the server, and its dependencies and settings to trusted
+//requests. An untrusted request with wrong credentials is rejected rather than served the
+//public part; the admin listener trusts any request, whatever it carries
+func infoHandler(a *Instance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin := a.trusted(r)
+		if !admin && r.Header.Get("Authorization") != "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		i := info{
+			Build:       a.build,
+			StartupTime: a.StartupTime,
+			UpTime:      time.Since(a.StartupTime).Round(time.Second).String(),
+		}
+		if admin {
+			if a.settings != nil {
+				i.Config = a.settings()
+			}
+		} else {
+			i.Build.Deps = nil
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(i)
+	}
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//KeyMaxBodyBytes is the route metadata key of the largest request body, an int64 in bytes,
+//accepted by the route instead of MAX_REQUEST_BODY_BYTES. 0 accepts any size
+const KeyMaxBodyBytes = "app.max-body-bytes"
+
+const (
+	rejectedMaxConnections = "max_connections"
+	rejectedBodyTooLarge   = "body_too_large"
+)
+
+var rejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_server_rejections_total",
+	Help: "Connections and requests rejected by the limits of the server, by reason.",
+}, []string{"reason"})
+
+//limitListener closes the connections accepted beyond max open ones
+type limitListener struct {
+	net.Listener
+	sem chan struct{}
+}
+
+//newLimitListener returns a listener whose open connections take a slot of sem, which
+//listeners may share to bound their connections together
+func newLimitListener(l net.Listener, sem chan struct{}) net.Listener {
+	return &limitListener{Listener: l, sem: sem}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case l.sem <- struct{}{}:
+			return &limitConn{Conn: c, release: func() { <-l.sem }}, nil
+		default:
+			rejections.WithLabelValues(rejectedMaxConnections).Inc()
+			c.Close()
+		}
+	}
+}
+
+//limitConn frees its slot of the limitListener once closed
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+//bodyLimits returns the KeyMaxBodyBytes of the routes of c which set it, by method and path
+func bodyLimits(c *restful.Container) map[string]int64 {
+	limits := map[string]int64{}
+	for _, ws := range c.RegisteredWebServices() {
+		for _, r := range ws.Routes() {
+			if n, ok := r.Metadata[KeyMaxBodyBytes].(int64); ok {
+				limits[r.Method+" "+r.Path] = n
+			}
+		}
+	}
+	return limits
+}
+
+//limitBody is a container filter rejecting request bodies larger than the limit of their
+//route, or than max for the routes without one
+func limitBody(max int64, limits map[string]int64) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		n := max
+		if l, ok := limits[req.Request.Method+" "+req.SelectedRoutePath()]; ok {
+			n = l
+		}
+		if n <= 0 || req.Request.Body == nil || req.Request.Body == http.NoBody {
+			chain.ProcessFilter(req, resp)
+			return
+		}
+		if req.Request.ContentLength > n {
+			rejections.WithLabelValues(rejectedBodyTooLarge).Inc()
+			resp.WriteErrorString(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+			return
+		}
+		req.Request.Body = newLimitedBody(resp.ResponseWriter, req.Request.Body, n)
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+//newLimitedBody returns body, failing the reads beyond max bytes
+func newLimitedBody(w http.ResponseWriter, body io.ReadCloser, max int64) io.ReadCloser {
+	counted := &countingReader{ReadCloser: body}
+	return &limitedBody{
+		ReadCloser: http.MaxBytesReader(w, counted, max),
+		counted:    counted,
+		max:        max,
+	}
+}
+
+//countingReader counts the bytes read
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+//limitedBody counts a rejection when the body read through http.MaxBytesReader goes beyond max,
+//and then fails with resource.ErrBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	counted  *countingReader
+	max      int64
+	rejected bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.counted.n > b.max {
+		if !b.rejected {
+			b.rejected = true
+			rejections.WithLabelValues(rejectedBodyTooLarge).Inc()
+		}
+		err = resource.ErrBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+	"github.com/jusongchen/REST-app/pkg/rest/swagger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitBody(t *testing.T) {
+	echo := func(req *restful.Request, resp *restful.Response) {
+		body, err := ioutil.ReadAll(req.Request.Body)
+		if errors.Is(err, resource.ErrBodyTooLarge) {
+			resp.WriteErrorString(http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			resp.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		resp.Write(body)
+	}
+	ws := new(restful.WebService).Path("/echo")
+	ws.Route(ws.POST("/").To(echo))
+	ws.Route(ws.POST("/large").To(echo).Metadata(KeyMaxBodyBytes, int64(100)))
+	c := restful.NewContainer()
+	c.Add(ws)
+	c.Filter(limitBody(10, bodyLimits(c)))
+
+	post := func(path string, body io.Reader) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, body))
+		return rec
+	}
+	rejected := func() float64 { return testutil.ToFloat64(rejections.WithLabelValues(rejectedBodyTooLarge)) }
+	before := rejected()
+
+	require.Equal(t, http.StatusOK, post("/echo/", strings.NewReader("0123456789")).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, post("/echo/", strings.NewReader("0123456789a")).Code)
+	require.Equal(t, before+1, rejected())
+
+	// A body of unknown length is cut while read
+	rec := post("/echo/", ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 50))))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "the read fails with resource.ErrBodyTooLarge")
+	require.Equal(t, before+2, rejected())
+
+	require.Equal(t, http.StatusOK, post("/echo/large", strings.NewReader(strings.Repeat("x", 100))).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, post("/echo/large", strings.NewReader(strings.Repeat("x", 101))).Code)
+}
+
+func TestLimitListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l = newLimitListener(l, make(chan struct{}, 1))
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+	rejected := func() float64 { return testutil.ToFloat64(rejections.WithLabelValues(rejectedMaxConnections)) }
+	before := rejected()
+
+	first, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	c := <-accepted
+
+	second, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = second.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err, "connection beyond the limit closed")
+	require.Equal(t, before+1, rejected())
+
+	c.Close()
+	third, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer third.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted once a slot is free")
+	}
+}
+
+func TestApp_Timeouts(t *testing.T) {
+	conf := Config{
+		SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", AdminHost: "127.0.0.1",
+		ReadHeaderTimeout: time.Second, IdleTimeout: time.Minute, MaxHeaderBytes: 4096,
+	}
+	a, err := New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	defer a.Svr.Close()
+	defer a.AdminSvr.Close()
+	for _, s := range []*http.Server{a.Svr.Config, a.AdminSvr.Config} {
+		require.Equal(t, time.Second, s.ReadHeaderTimeout)
+		require.Equal(t, time.Minute, s.IdleTimeout)
+		require.Equal(t, 4096, s.MaxHeaderBytes)
+	}
+
+	// A client sending its headers too slowly is disconnected
+	a.Svr.Start()
+	conn, err := net.Dial("tcp", a.Svr.Listeners[0].Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET /healthz HTTP/1.1\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = ioutil.ReadAll(conn)
+	require.NoError(t, err)
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation, SD_LISTEN_FDS_START.
+var listenFDsStart = 3
+
+// listen opens the listener of address, either host:port or a URL:
+//
+//	tcp://host:port
+//	unix:///run/demoapp.sock?mode=0660
+//	fd://             the first socket passed by systemd, see sd_listen_fds(3)
+//	fd://N or fd://name  the Nth socket passed by systemd, or the one of FileDescriptorName=name
+func listen(address string) (net.Listener, error) {
+	if !strings.Contains(address, "://") {
+		return net.Listen("tcp", address)
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("listener URL %q: %w", address, err)
+	}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		return net.Listen(u.Scheme, u.Host)
+	case "unix":
+		return listenUnix(u)
+	case "fd":
+		return listenFD(u.Host)
+	default:
+		return nil, fmt.Errorf("listener URL %q: unsupported scheme %q, want tcp, unix or fd", address, u.Scheme)
+	}
+}
+
+// checkListenURL reports whether address is a listener URL listen knows
+// how to open, without opening it.
+func checkListenURL(address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return err
+		}
+	case "unix":
+		if u.Path == "" {
+			return errors.New("unix listener URL has no path")
+		}
+		if mode := u.Query().Get("mode"); mode != "" {
+			if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+				return fmt.Errorf("mode %q is not an octal file mode", mode)
+			}
+		}
+	case "fd":
+	default:
+		return fmt.Errorf("unsupported scheme %q, want tcp, unix or fd", u.Scheme)
+	}
+	return nil
+}
+
+// checkListenAddr reports whether address is a listener URL or a host:port
+// address listen knows how to open, without opening it.
+func checkListenAddr(address string) error {
+	if strings.Contains(address, "://") {
+		return checkListenURL(address)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	return checkHost(host)
+}
+
+// checkHost reports whether host is an IP, a hostname, or empty or * for
+// all the interfaces.
+func checkHost(host string) error {
+	if host == "" || host == "*" || net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(host) > 253 {
+		return fmt.Errorf("hostname %q is longer than 253 characters", host)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%q is neither an IP address nor a hostname", host)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("%q is neither an IP address nor a hostname", host)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveAddrs replaces the host:port addresses of addrs whose host is a
+// hostname by an address for each IP the hostname resolves to. Listener URLs
+// are kept as they are.
+func resolveAddrs(addrs []string) ([]string, error) {
+	var resolved []string
+	for _, addr := range addrs {
+		if strings.Contains(addr, "://") {
+			resolved = append(resolved, addr)
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("bind address %q: %w", addr, err)
+		}
+		hosts, err := resolveHost(host)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hosts {
+			resolved = append(resolved, net.JoinHostPort(h, port))
+		}
+	}
+	return resolved, nil
+}
+
+// resolveHost returns the IPs to listen on for host: host itself if it is an
+// IP, "" for all the interfaces if it is empty or *, or the IPs a hostname
+// resolves to. An empty or unspecified IP listens on IPv4 and IPv6 both.
+func resolveHost(host string) ([]string, error) {
+	if host == "*" {
+		return []string{""}, nil
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", host, err)
+	}
+	var hosts []string
+	seen := map[string]bool{}
+	for _, ip := range ips {
+		if h := ip.String(); !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, nil
+}
+
+// listenUnix listens on the socket file of u, replacing a stale one, with
+// the permissions of its mode query parameter.
+func listenUnix(u *url.URL) (net.Listener, error) {
+	path := u.Path
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		// left by a previous run which did not close its listener
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket %s: %w", path, err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode := u.Query().Get("mode"); mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("socket mode %q: %w", mode, err)
+		}
+		if err := os.Chmod(path, os.FileMode(m)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// listenFD returns the socket passed by systemd named by name: its index
+// among LISTEN_FDS, its name in LISTEN_FDNAMES, or the first one if empty.
+func listenFD(name string) (net.Listener, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, fmt.Errorf("systemd sockets are passed to process %s, not to this one", pid)
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, errors.New("no socket passed by systemd, LISTEN_FDS is not set")
+	}
+
+	i := 0
+	if name != "" {
+		i = -1
+		if idx, err := strconv.Atoi(name); err == nil {
+			i = idx
+		} else {
+			for j, fdName := range strings.Split(os.Getenv("LISTEN_FDNAMES"), ":") {
+				if fdName == name {
+					i = j
+					break
+				}
+			}
+		}
+		if i < 0 || i >= n {
+			return nil, fmt.Errorf("no socket %q among the %d passed by systemd", name, n)
+		}
+	}
+
+	f := os.NewFile(uintptr(listenFDsStart+i), "LISTEN_FD_"+strconv.Itoa(i))
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket %d: %w", i, err)
+	}
+	return l, nil
+}
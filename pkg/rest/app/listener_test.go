@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/jusongchen/REST-app/pkg/rest/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen_Unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	conf := Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", Listen: []string{"unix://" + path + "?mode=0660"}}
+	require.NoError(t, conf.Validate())
+	a, err := New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+	require.Equal(t, "unix://"+path, a.Svr.URLs[0])
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://app" + HealthzPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	client.CloseIdleConnections()
+
+	a.Close()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "socket removed on close")
+}
+
+func TestListen_FD(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+	// listenFD takes over the descriptor as systemd passed it
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	f.Close()
+
+	defer func(start int) { listenFDsStart = start }(listenFDsStart)
+	listenFDsStart = fd - 1
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "admin:http")
+
+	_, err = listen("fd://3")
+	require.Error(t, err)
+
+	l, err := listen("fd://http")
+	require.NoError(t, err)
+	require.Equal(t, tcp.Addr().String(), l.Addr().String())
+	l.Close()
+
+	t.Setenv("LISTEN_PID", "1")
+	_, err = listen("fd://")
+	require.Error(t, err)
+}
+
+func TestListen_Errors(t *testing.T) {
+	for _, address := range []string{"udp://127.0.0.1:0", "unix://", "tcp://127.0.0.1", "unix:///tmp/x.sock?mode=rw"} {
+		require.Error(t, checkListenURL(address), address)
+	}
+	for _, address := range []string{"tcp://127.0.0.1:0", "unix:///run/demoapp.sock?mode=0660", "fd://", "fd://http"} {
+		require.NoError(t, checkListenURL(address), address)
+	}
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+	_, port, _ := net.SplitHostPort(busy.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	_, err = New(Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", Port: uint(p)}, swagger.ServerInfo{})
+	require.Error(t, err, "port in use is an error, not a panic")
+}
+
+func TestListen_Multiple(t *testing.T) {
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skip("no IPv6 loopback:", err)
+	} else {
+		l.Close()
+	}
+
+	conf := Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", Listen: []string{"127.0.0.1:0", "[::1]:0", "localhost:0"}}
+	require.NoError(t, conf.Validate())
+	a, err := New(conf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+	defer a.Close()
+
+	require.GreaterOrEqual(t, len(a.Svr.URLs), 3, "localhost resolves to an address at least")
+	require.Contains(t, a.Svr.URLs[1], "http://[::1]:")
+	for _, u := range a.Svr.URLs {
+		resp, err := http.Get(u + HealthzPath)
+		require.NoError(t, err, u)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, u)
+	}
+}
+
+func TestResolveAddrs(t *testing.T) {
+	addrs, err := resolveAddrs([]string{"*:8080", "[::]:8080", "0.0.0.0:8080", "unix:///run/demoapp.sock", "localhost:8080"})
+	require.NoError(t, err)
+	require.Equal(t, []string{":8080", "[::]:8080", "0.0.0.0:8080", "unix:///run/demoapp.sock"}, addrs[:4])
+	require.Contains(t, addrs[4:], "127.0.0.1:8080")
+
+	_, err = resolveAddrs([]string{"no-such-host.invalid:8080"})
+	require.Error(t, err)
+
+	for _, host := range []string{"", "*", "::", "localhost", "api-1.example.com."} {
+		require.NoError(t, checkHost(host), host)
+	}
+	for _, host := range []string{"not a host", "-api.example.com", "api..example.com", "api_1"} {
+		require.Error(t, checkHost(host), host)
+	}
+	require.Error(t, checkListenAddr("localhost"), "missing port")
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/go-openapi/spec"
+)
+
+//Mount serves h on the paths under prefix, next to the web services: a plain http.Handler
+//tree, a chi router or a grpc-gateway mux. h gets the requests with their path unchanged,
+//e.g. /v2/orders/1 for the prefix /v2/. The container filters, such as the CORS filter and
+//the request body limit of MaxRequestBodyBytes, apply to h, then filters, as the filters of
+//a web service would, e.g. middleware.RequestIDRest, middleware.Logging or idempotency.Filter.
+//
+//doc, if not nil, documents the routes of h in /apidocs.json: its paths, all under prefix,
+//definitions and tags are merged with those of the web services. It must be called before Start
+func (a *Instance) Mount(prefix string, h http.Handler, doc *spec.Swagger, filters ...restful.FilterFunction) error {
+	if len(a.Svr.URLs) > 0 {
+		return fmt.Errorf("mount %s: the server is started already", prefix)
+	}
+	if !strings.HasPrefix(prefix, "/") || prefix == "/" {
+		return fmt.Errorf("mount prefix %q must be a path below /", prefix)
+	}
+	pattern := strings.TrimSuffix(prefix, "/") + "/"
+	mux := a.Container.ServeMux
+	if _, taken := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: pattern}}); taken == pattern {
+		return fmt.Errorf("mount %s: the path is served already", pattern)
+	}
+
+	if doc != nil {
+		if doc.Paths != nil {
+			var outside []string
+			for p := range doc.Paths.Paths {
+				if !strings.HasPrefix(p, pattern) {
+					outside = append(outside, p)
+				}
+			}
+			if len(outside) > 0 {
+				sort.Strings(outside)
+				return fmt.Errorf("mount %s documents paths not under it: %s", pattern, strings.Join(outside, ", "))
+			}
+		}
+		if err := a.docs.Merge(doc); err != nil {
+			return fmt.Errorf("mount %s: %w", pattern, err)
+		}
+	}
+	a.Container.HandleWithFilter(pattern, filtered(h, filters))
+	return nil
+}
+
+//filtered runs filters before h
+func filtered(h http.Handler, filters []restful.FilterFunction) http.Handler {
+	if len(filters) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain := restful.FilterChain{Filters: filters, Target: func(req *restful.Request, resp *restful.Response) {
+			h.ServeHTTP(resp, req.Request)
+		}}
+		chain.ProcessFilter(restful.NewRequest(r), restful.NewResponse(w))
+	})
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/go-openapi/spec"
+	"github.com/jusongchen/REST-app/pkg/reqid"
+	"github.com/jusongchen/REST-app/pkg/rest/middleware"
+	"github.com/jusongchen/REST-app/pkg/rest/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMount(t *testing.T) {
+	u := UserResource{map[string]User{}}
+	a, err := New(Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", MaxRequestBodyBytes: 8}, swagger.ServerInfo{}, u.WebService())
+	require.NoError(t, err)
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, r.URL.Path)
+	})
+	doc := &spec.Swagger{SwaggerProps: spec.SwaggerProps{
+		Paths: &spec.Paths{Paths: map[string]spec.PathItem{
+			"/v2/orders/{id}": {PathItemProps: spec.PathItemProps{Get: spec.NewOperation("getOrder").WithTags("orders")}},
+		}},
+		Definitions: spec.Definitions{"Order": *spec.StringProperty()},
+		Tags:        []spec.Tag{spec.NewTag("orders", "Orders of the v2 API", nil)},
+	}}
+	a.Container.Filter(func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		resp.AddHeader("X-Container-Filter", "yes")
+		chain.ProcessFilter(req, resp)
+	})
+	mountFilter := func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		resp.AddHeader("X-Mount-Filter", "yes")
+		chain.ProcessFilter(req, resp)
+	}
+	require.NoError(t, a.Mount("/v2", echo, doc, mountFilter))
+
+	require.Error(t, a.Mount("/v2/", echo, nil), "prefix taken by a mount")
+	require.Error(t, a.Mount(userResourceRootPath, echo, nil), "prefix taken by a web service")
+	require.Error(t, a.Mount("/", echo, nil))
+	outside := &spec.Swagger{SwaggerProps: spec.SwaggerProps{Paths: &spec.Paths{Paths: map[string]spec.PathItem{"/v1/orders": {}}}}}
+	require.Error(t, a.Mount("/v3", echo, outside))
+	require.Error(t, a.docs.Merge(doc), "path documented already")
+
+	require.NoError(t, a.Start())
+	defer a.Close()
+	base := a.Svr.URLs[0]
+
+	resp, err := http.Get(base + "/v2/orders/1")
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "/v2/orders/1", string(body))
+	require.Equal(t, "yes", resp.Header.Get("X-Container-Filter"))
+	require.Equal(t, "yes", resp.Header.Get("X-Mount-Filter"))
+
+	resp, err = http.Post(base+"/v2/orders", "text/plain", strings.NewReader("more than eight bytes"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	require.Error(t, a.Mount("/v4", echo, nil), "started already")
+
+	rec := httptest.NewRecorder()
+	a.Container.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apidocs.json", nil))
+	var merged spec.Swagger
+	require.NoError(t, merged.UnmarshalJSON(rec.Body.Bytes()))
+	require.Contains(t, merged.Paths.Paths, "/v2/orders/{id}")
+	require.Contains(t, merged.Paths.Paths, userResourceRootPath)
+	require.Contains(t, merged.Definitions, "Order")
+	require.True(t, len(merged.Tags) > 0 && merged.Tags[len(merged.Tags)-1].Name == "orders")
+}
+
+func TestMount_RequestID(t *testing.T) {
+	a, err := New(Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1"}, swagger.ServerInfo{})
+	require.NoError(t, err)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, reqid.FromContext(r.Context()))
+	})
+	require.NoError(t, a.Mount("/v2", h, nil, middleware.RequestIDRest, middleware.Logging))
+
+	rec := httptest.NewRecorder()
+	a.Container.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/orders", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotEmpty(t, rec.Body.String(), "the handler sees the request ID")
+}
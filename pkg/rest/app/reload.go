@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//reloadTimeout bounds how long a configuration reload may take
+const reloadTimeout = 30 * time.Second
+
+//Reloader re-reads the configuration and applies the settings which can change while the server runs
+type Reloader interface {
+	//Reload loads the configuration again. Changes of reloadable settings are applied,
+	//changes of the other settings are rejected
+	Reload(ctx context.Context) ReloadResult
+}
+
+//ReloadResult is the outcome of a configuration reload
+type ReloadResult struct {
+	Time     time.Time       `json:"time"`
+	Trigger  string          `json:"trigger"`
+	Applied  []config.Change `json:"applied,omitempty"`
+	Rejected []config.Change `json:"rejected,omitempty"`
+	//Error is set when the configuration could not be loaded or a change could not be applied
+	Error string `json:"error,omitempty"`
+}
+
+//reloads runs the reloader of an Instance one at a time and keeps the last result
+type reloads struct {
+	reloader Reloader
+	file     string
+
+	mu   sync.Mutex
+	last *ReloadResult
+}
+
+//SetReloader makes r reload the configuration on SIGHUP. If file is not empty and
+//CONFIG_WATCH_INTERVAL is set, the configuration is also reloaded when file changes.
+//It must be called before Run
+func (a *Instance) SetReloader(r Reloader, file string) {
+	a.reloads.reloader = r
+	a.reloads.file = file
+}
+
+//Reload reloads the configuration, if a Reloader is set, logging what changed
+func (a *Instance) Reload(trigger string) (ReloadResult, bool) {
+	if a.reloads.reloader == nil {
+		return ReloadResult{}, false
+	}
+	a.reloads.mu.Lock()
+	defer a.reloads.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+	defer cancel()
+	res := a.reloads.reloader.Reload(ctx)
+	res.Time, res.Trigger = time.Now(), trigger
+	a.reloads.last = &res
+
+	for _, c := range res.Applied {
+		log.Infof("config reload: %s changed from %q to %q", c.Key, c.Old, c.New)
+	}
+	for _, c := range res.Rejected {
+		log.Warnf("config reload: %s cannot change while serving, keeping %q instead of %q", c.Key, c.Old, c.New)
+	}
+	if res.Error != "" {
+		log.Errorf("config reload: %s", res.Error)
+	}
+	return res, true
+}
+
+//LastReload returns the result of the last configuration reload, nil if there was none
+func (a *Instance) LastReload() *ReloadResult {
+	a.reloads.mu.Lock()
+	defer a.reloads.mu.Unlock()
+	return a.reloads.last
+}
+
+//watchConfig reloads the configuration whenever the config file changes until ctx is done
+func (a *Instance) watchConfig(ctx context.Context) {
+	if a.reloads.reloader == nil || a.reloads.file == "" || a.ConfigWatchInterval <= 0 {
+		return
+	}
+	go config.Watch(ctx, a.reloads.file, a.ConfigWatchInterval, func() {
+		a.Reload("file")
+	})
+}
+
+//reloadStatus serves the result of the last configuration reload
+func reloadStatus(a *Instance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		last := a.LastReload()
+		if last == nil {
+			http.Error(w, "configuration not reloaded yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(last)
+	}
+}
@@ -0,0 +1,268 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//upgradeListenersEnv passes the listeners to the new process of an upgrade, as a JSON
+	//array holding, for each server in the order they were created, its listeners in order
+	upgradeListenersEnv = "APP_UPGRADE_LISTENERS"
+	//upgradeReadyEnv is the file descriptor the new process closes once it serves
+	upgradeReadyEnv = "APP_UPGRADE_READY_FD"
+	//upgradeTimeout bounds how long the new process of an upgrade may take to serve
+	upgradeTimeout = time.Minute
+)
+
+//handedListener is a listener handed over to the new process of an upgrade
+type handedListener struct {
+	//Addr is the address the listener was created with
+	Addr string `json:"addr"`
+	//FD is its file descriptor in the new process
+	FD int `json:"fd"`
+}
+
+//upgradeCommand returns the binary and the arguments of the new process of an upgrade:
+//the binary at the path of the running one, which may have been replaced by a new version
+var upgradeCommand = func() (string, []string, error) {
+	exe, err := os.Executable()
+	return exe, os.Args[1:], err
+}
+
+//Upgrade starts the binary again, possibly a new version of it, handing over the listeners
+//so that no connection is refused meanwhile. It returns once the new process serves; the
+//caller then closes a, which drains the connections a still has
+func (a *Instance) Upgrade() error {
+	servers := []*Server{a.Svr}
+	if a.AdminSvr != nil {
+		servers = append(servers, a.AdminSvr)
+	}
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	defer readyW.Close()
+
+	// The new process gets stdin, stdout, stderr, the writer of ready as
+	// fd 3, then the listeners.
+	files := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd(), readyW.Fd()}
+	var listeners [][]handedListener
+	for _, s := range servers {
+		var handed []handedListener
+		for i, l := range s.raw {
+			fd, err := listenerFD(l)
+			if err != nil {
+				return fmt.Errorf("listener %s: %w", s.addrs[i], err)
+			}
+			defer syscall.Close(fd)
+			handed = append(handed, handedListener{Addr: s.addrs[i], FD: len(files)})
+			files = append(files, uintptr(fd))
+		}
+		listeners = append(listeners, handed)
+	}
+	fds, err := json.Marshal(listeners)
+	if err != nil {
+		return err
+	}
+
+	exe, args, err := upgradeCommand()
+	if err != nil {
+		return err
+	}
+	// os/exec would switch the listeners to blocking mode, which their
+	// duplicates share, through os.File.Fd: fork and exec directly.
+	pid, err := syscall.ForkExec(exe, append([]string{exe}, args...), &syscall.ProcAttr{
+		Env: append(environWithout(upgradeListenersEnv, upgradeReadyEnv),
+			upgradeListenersEnv+"="+string(fds),
+			upgradeReadyEnv+"=3",
+		),
+		Files: files,
+	})
+	if err != nil {
+		return fmt.Errorf("starting %s: %w", exe, err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	log.Infof("upgrade: started %s as process %d", exe, pid)
+	// Only the new process may hold the writer, so that a read ends once it exits
+	readyW.Close()
+
+	if err := waitReady(ready, upgradeTimeout); err != nil {
+		process.Kill()
+		process.Wait()
+		return fmt.Errorf("process %d: %w", pid, err)
+	}
+	for _, s := range servers {
+		for _, l := range s.raw {
+			if ul, ok := l.(*net.UnixListener); ok {
+				// the socket file now belongs to the new process
+				ul.SetUnlinkOnClose(false)
+			}
+		}
+	}
+	return process.Release()
+}
+
+//listenerFD returns a duplicate, closed on exec, of the file descriptor of l
+func listenerFD(l net.Listener) (int, error) {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return -1, fmt.Errorf("cannot hand over a %T", l)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	dup := -1
+	var dupErr error
+	err = rc.Control(func(fd uintptr) {
+		r, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_DUPFD_CLOEXEC, 0)
+		if errno != 0 {
+			dupErr = errno
+			return
+		}
+		dup = int(r)
+	})
+	if err != nil {
+		return -1, err
+	}
+	return dup, dupErr
+}
+
+//waitReady waits until the new process writes to ready
+func waitReady(ready *os.File, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		n, err := ready.Read(make([]byte, 1))
+		if n == 1 {
+			err = nil
+		} else if err == io.EOF {
+			err = errors.New("exited or gave up before serving")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("not serving after %v", timeout)
+	}
+}
+
+//environWithout returns the environment without the variables of names
+func environWithout(names ...string) []string {
+	var env []string
+next:
+	for _, kv := range os.Environ() {
+		for _, name := range names {
+			if strings.HasPrefix(kv, name+"=") {
+				continue next
+			}
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+var (
+	inheritedOnce sync.Once
+	inherited     [][]handedListener
+)
+
+//inheritedListeners returns the listeners of the next server handed over by the process
+//this one upgrades, if any. As servers are created in the same order in both processes,
+//the server must have the listeners of addrs, in that order, or it is an error
+func inheritedListeners(addrs []string) ([]net.Listener, bool, error) {
+	inheritedOnce.Do(func() {
+		if fds := os.Getenv(upgradeListenersEnv); fds != "" {
+			if err := json.Unmarshal([]byte(fds), &inherited); err != nil {
+				log.Errorf("upgrade: %s: %v", upgradeListenersEnv, err)
+			}
+			os.Unsetenv(upgradeListenersEnv)
+		}
+	})
+	if len(inherited) == 0 {
+		return nil, false, nil
+	}
+	handed := inherited[0]
+	inherited = inherited[1:]
+
+	var got []string
+	for _, h := range handed {
+		got = append(got, h.Addr)
+	}
+	if strings.Join(got, ",") != strings.Join(addrs, ",") {
+		closeHanded(handed)
+		return nil, true, fmt.Errorf("upgrade: handed over the listeners of %q, the server has %q", got, addrs)
+	}
+
+	var listeners []net.Listener
+	for i, h := range handed {
+		f := os.NewFile(uintptr(h.FD), "listener "+h.Addr)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			closeHanded(handed[i+1:])
+			return nil, true, fmt.Errorf("inherited listener %s: %w", h.Addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, true, nil
+}
+
+//checkInheritedUsed returns an error if the process this one upgrades handed over the
+//listeners of more servers than this one created, closing them
+func checkInheritedUsed() error {
+	if len(inherited) == 0 {
+		return nil
+	}
+	n := len(inherited)
+	for _, handed := range inherited {
+		closeHanded(handed)
+	}
+	inherited = nil
+	return fmt.Errorf("upgrade: handed over the listeners of %d more servers than served", n)
+}
+
+//closeHanded closes the file descriptors of handed
+func closeHanded(handed []handedListener) {
+	for _, h := range handed {
+		syscall.Close(h.FD)
+	}
+}
+
+//notifyUpgradeReady tells the process this one upgrades that it serves
+func notifyUpgradeReady() {
+	fd := os.Getenv(upgradeReadyEnv)
+	if fd == "" {
+		return
+	}
+	os.Unsetenv(upgradeReadyEnv)
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		log.Errorf("upgrade: %s: %v", upgradeReadyEnv, err)
+		return
+	}
+	f := os.NewFile(uintptr(n), "upgrade ready")
+	f.Write([]byte{1})
+	f.Close()
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/rest/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+var upgradeConf = Config{SwaggerDir: "./testdata/swaggerUI", Host: "127.0.0.1", AdminToken: "s3cret"}
+
+//TestUpgradeChild is the new process of TestUpgrade: it serves /home on the listener it
+//inherits, showing it is the new process, until the first request for it
+func TestUpgradeChild(t *testing.T) {
+	if os.Getenv(upgradeReadyEnv) == "" {
+		t.Skip("run by TestUpgrade")
+	}
+	a, err := New(upgradeConf, swagger.ServerInfo{})
+	require.NoError(t, err)
+
+	served := make(chan struct{})
+	a.AddStatus("upgraded", func() interface{} {
+		defer close(served)
+		return os.Getpid()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	go func() {
+		<-served
+		cancel()
+	}()
+	a.Run(ctx)
+}
+
+func TestUpgrade(t *testing.T) {
+	defer func(c func() (string, []string, error)) { upgradeCommand = c }(upgradeCommand)
+	upgradeCommand = func() (string, []string, error) {
+		exe, err := os.Executable()
+		return exe, []string{"-test.run=^TestUpgradeChild$"}, err
+	}
+
+	a, err := New(upgradeConf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+	url := a.Svr.URLs[0]
+
+	require.NoError(t, a.Upgrade())
+	a.Close()
+
+	req, err := http.NewRequest(http.MethodGet, url+HomePath, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+upgradeConf.AdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), `"upgraded"`, "served by the new process on the same port")
+}
+
+func TestUpgrade_ChildFails(t *testing.T) {
+	defer func(c func() (string, []string, error)) { upgradeCommand = c }(upgradeCommand)
+	upgradeCommand = func() (string, []string, error) { return "/bin/false", nil, nil }
+
+	a, err := New(upgradeConf, swagger.ServerInfo{})
+	require.NoError(t, err)
+	require.NoError(t, a.Start())
+	defer a.Close()
+
+	require.Error(t, a.Upgrade())
+	resp, err := http.Get(a.Svr.URLs[0] + HealthzPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "still serving")
+}
+
+//handOver sets the environment of a new process of an upgrade handing over the listeners
+//of servers, with the addresses of addrs, and returns the originals
+func handOver(t *testing.T, addrs [][]string) [][]net.Listener {
+	t.Helper()
+	var listeners [][]net.Listener
+	var handed [][]handedListener
+	for _, server := range addrs {
+		var ls []net.Listener
+		var hs []handedListener
+		for _, addr := range server {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			t.Cleanup(func() { l.Close() })
+			fd, err := listenerFD(l)
+			require.NoError(t, err)
+			ls = append(ls, l)
+			hs = append(hs, handedListener{Addr: addr, FD: fd})
+		}
+		listeners = append(listeners, ls)
+		handed = append(handed, hs)
+	}
+	fds, err := json.Marshal(handed)
+	require.NoError(t, err)
+	t.Setenv(upgradeListenersEnv, string(fds))
+	inheritedOnce = sync.Once{}
+	t.Cleanup(func() { inherited = nil })
+	return listeners
+}
+
+func TestInheritedListeners(t *testing.T) {
+	addrs := []string{"127.0.0.1:0", "127.0.0.1:0"}
+	originals := handOver(t, [][]string{addrs, {"127.0.0.1:0"}})
+
+	s, err := newUnstartedServer(addrs, healthz())
+	require.NoError(t, err)
+	defer s.closeListeners()
+	require.Len(t, s.Listeners, 2)
+	for i, l := range s.Listeners {
+		require.Equal(t, originals[0][i].Addr().String(), l.Addr().String(), "by index, not by address")
+	}
+
+	require.Error(t, checkInheritedUsed(), "the listeners of a second server are left")
+	require.NoError(t, checkInheritedUsed())
+}
+
+func TestInheritedListeners_Mismatch(t *testing.T) {
+	handOver(t, [][]string{{"127.0.0.1:0"}})
+	_, err := newUnstartedServer([]string{"127.0.0.1:0", "[::1]:0"}, healthz())
+	require.Error(t, err, "a listener more than handed over")
+
+	handOver(t, [][]string{{"127.0.0.1:8080"}})
+	_, err = newUnstartedServer([]string{"127.0.0.1:0"}, healthz())
+	require.Error(t, err, "another address")
+}
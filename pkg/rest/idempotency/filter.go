@@ -0,0 +1,208 @@
+// Package idempotency provides a go-restful filter which makes unsafe requests
+// safe to retry: a request carrying an Idempotency-Key header is processed once
+// and retries with the same key get the stored response.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jusongchen/REST-app/pkg/rest/middleware"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// KeyHeader is the request header carrying the client chosen key.
+	KeyHeader = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on responses replayed from the store.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// DefaultTTL is how long a response is kept for replay.
+	DefaultTTL = 24 * time.Hour
+	// DefaultLockWait is how long a request waits for another one with the
+	// same key to finish before it is answered 409 Conflict.
+	DefaultLockWait = 10 * time.Second
+	// MaxKeyLength is the longest key accepted.
+	MaxKeyLength = 255
+)
+
+// Option configures the filter.
+type Option func(*filter)
+
+// WithTTL sets how long responses are kept for replay.
+func WithTTL(ttl time.Duration) Option {
+	return func(f *filter) { f.ttl = ttl }
+}
+
+// WithLockWait sets how long a request waits for another one with the same
+// key to finish.
+func WithLockWait(d time.Duration) Option {
+	return func(f *filter) { f.lockWait = d }
+}
+
+// WithClientFunc sets how the client a key belongs to is identified. Keys of
+// different clients never collide. The default uses the Authorization header
+// if present, and the remote IP otherwise.
+func WithClientFunc(fn func(r *http.Request) string) Option {
+	return func(f *filter) { f.client = fn }
+}
+
+type filter struct {
+	store    Store
+	ttl      time.Duration
+	lockWait time.Duration
+	client   func(r *http.Request) string
+}
+
+// Filter returns a go-restful filter which honours the Idempotency-Key header
+// on POST, PUT, PATCH and DELETE requests. The first response to a key is
+// stored, unless it is a server error, and replayed for later requests with the
+// same key. Reusing a key with a different request is rejected with 422.
+// Concurrent requests with the same key are processed one after the other; one
+// waiting longer than the lock wait, see WithLockWait, is rejected with 409.
+func Filter(store Store, opts ...Option) restful.FilterFunction {
+	f := &filter{store: store, ttl: DefaultTTL, lockWait: DefaultLockWait, client: defaultClient}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f.process
+}
+
+func (f *filter) process(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	r := req.Request
+	key := r.Header.Get(KeyHeader)
+	if key == "" || !unsafeMethod(r.Method) {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+	if len(key) > MaxKeyLength {
+		resp.WriteErrorString(http.StatusBadRequest, "Idempotency-Key is too long")
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if errors.Is(err, resource.ErrBodyTooLarge) {
+		resp.WriteErrorString(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+		return
+	}
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	ctx := r.Context()
+	client := f.client(r)
+	fingerprint := requestFingerprint(r, body)
+	reqID := middleware.GetReqID(ctx)
+
+	lockCtx, cancel := context.WithTimeout(ctx, f.lockWait)
+	unlock, err := f.store.Lock(lockCtx, client, key)
+	cancel()
+	switch {
+	case errors.Is(err, ErrInProgress):
+		resp.WriteErrorString(http.StatusConflict, "request with the same Idempotency-Key is in progress")
+		return
+	case err != nil:
+		log.WithField("request_id", reqID).Errorf("idempotency: locking key: %v", err)
+		resp.WriteErrorString(http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+		return
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			log.WithField("request_id", reqID).Errorf("idempotency: unlocking key: %v", err)
+		}
+	}()
+
+	rec, err := f.store.Get(ctx, client, key)
+	switch {
+	case err == nil:
+		if rec.Fingerprint != fingerprint {
+			resp.WriteErrorString(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			return
+		}
+		replay(resp, rec)
+		return
+	case !errors.Is(err, ErrNotFound):
+		log.WithField("request_id", reqID).Errorf("idempotency: reading key: %v", err)
+		resp.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c := middleware.NewResponseCapture(resp.ResponseWriter)
+	resp.ResponseWriter = c
+	chain.ProcessFilter(req, resp)
+
+	status := c.StatusCode()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= 500 {
+		// Let the client retry server errors.
+		return
+	}
+
+	now := time.Now()
+	rec = &Record{
+		Client:      client,
+		Key:         key,
+		Fingerprint: fingerprint,
+		StatusCode:  status,
+		Header:      c.Header().Clone(),
+		Body:        c.Bytes(),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(f.ttl),
+	}
+	// The response was sent, store it even if the client has gone away meanwhile.
+	if err := f.store.Put(context.Background(), rec); err != nil {
+		log.WithField("request_id", reqID).Errorf("idempotency: storing response: %v", err)
+	}
+}
+
+func replay(resp *restful.Response, rec *Record) {
+	h := resp.Header()
+	for k, v := range rec.Header {
+		h[k] = v
+	}
+	h.Set(ReplayedHeader, "true")
+	resp.WriteHeader(rec.StatusCode)
+	resp.Write(rec.Body)
+}
+
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestFingerprint identifies what a request asks for, so that a key reused
+// for a different request can be detected.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func defaultClient(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
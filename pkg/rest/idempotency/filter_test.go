@@ -0,0 +1,193 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jusongchen/REST-app/pkg/rest/resource"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves POST /items, which answers with a sequence number,
+// and POST /fail, which always fails.
+func newTestServer(t *testing.T, store Store, calls *int64, opts ...Option) *httptest.Server {
+	t.Helper()
+	ws := new(restful.WebService)
+	ws.Path("/").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Filter(Filter(store, append([]Option{WithTTL(time.Minute)}, opts...)...))
+	ws.Route(ws.POST("/items").To(func(req *restful.Request, resp *restful.Response) {
+		n := atomic.AddInt64(calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		resp.AddHeader("Location", fmt.Sprintf("/items/%d", n))
+		resp.WriteHeaderAndEntity(http.StatusCreated, map[string]int64{"n": n})
+	}))
+	ws.Route(ws.POST("/fail").To(func(req *restful.Request, resp *restful.Response) {
+		atomic.AddInt64(calls, 1)
+		resp.WriteErrorString(http.StatusInternalServerError, "boom")
+	}))
+
+	c := restful.NewContainer()
+	c.Add(ws)
+	ts := httptest.NewServer(c)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, url, key, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	if key != "" {
+		req.Header.Set(KeyHeader, key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(data)
+}
+
+func TestFilter(t *testing.T) {
+	var calls int64
+	ts := newTestServer(t, NewMemoryStore(), &calls)
+
+	resp, first := post(t, ts.URL+"/items", "k1", `{"a":1}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(ReplayedHeader))
+
+	resp, replayed := post(t, ts.URL+"/items", "k1", `{"a":1}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(ReplayedHeader))
+	require.Equal(t, "/items/1", resp.Header.Get("Location"))
+	require.Equal(t, first, replayed)
+	require.Equal(t, int64(1), atomic.LoadInt64(&calls))
+
+	resp, _ = post(t, ts.URL+"/items", "k1", `{"a":2}`)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// Without a key, or with a new key, requests are processed.
+	post(t, ts.URL+"/items", "", `{"a":1}`)
+	post(t, ts.URL+"/items", "k2", `{"a":1}`)
+	require.Equal(t, int64(3), atomic.LoadInt64(&calls))
+
+	// Server errors are not stored.
+	post(t, ts.URL+"/fail", "k3", `{}`)
+	resp, _ = post(t, ts.URL+"/fail", "k3", `{}`)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, int64(5), atomic.LoadInt64(&calls))
+
+	resp, _ = post(t, ts.URL+"/items", strings.Repeat("k", MaxKeyLength+1), `{}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestFilter_ConcurrentDuplicates(t *testing.T) {
+	var calls int64
+	ts := newTestServer(t, NewMemoryStore(), &calls)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, bodies[i] = post(t, ts.URL+"/items", "same", `{}`)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(1), atomic.LoadInt64(&calls))
+	for _, b := range bodies {
+		require.Equal(t, bodies[0], b)
+	}
+}
+
+// lockFailingStore fails to lock any key.
+type lockFailingStore struct {
+	Store
+}
+
+func (lockFailingStore) Lock(ctx context.Context, client, key string) (UnlockFn, error) {
+	return nil, errors.New("connection refused")
+}
+
+// failingReader fails every read with err.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) { return 0, r.err }
+
+func TestFilter_Errors(t *testing.T) {
+	var calls int64
+	store := NewMemoryStore()
+	ts := newTestServer(t, store, &calls, WithLockWait(50*time.Millisecond))
+
+	// A request with the key of one in progress gives up waiting.
+	unlock, err := store.Lock(context.Background(), "ip:127.0.0.1", "busy")
+	require.NoError(t, err)
+	resp, _ := post(t, ts.URL+"/items", "busy", `{}`)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.NoError(t, unlock())
+
+	// A store failure is not a request in progress.
+	ts = newTestServer(t, lockFailingStore{store}, &calls)
+	resp, body := post(t, ts.URL+"/items", "k", `{}`)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NotContains(t, body, "in progress")
+
+	// A body beyond the limit of the route is too large, not a bad request.
+	req := httptest.NewRequest(http.MethodPost, "/items", ioutil.NopCloser(failingReader{resource.ErrBodyTooLarge}))
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	req.Header.Set(KeyHeader, "big")
+	rec := httptest.NewRecorder()
+	ts.Config.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Equal(t, int64(0), atomic.LoadInt64(&calls))
+}
+
+func TestMemoryStore_Purge(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore().(*memoryStore)
+
+	require.NoError(t, s.Put(ctx, &Record{Client: "c", Key: "old", ExpiresAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, s.Put(ctx, &Record{Client: "c", Key: "new", ExpiresAt: time.Now().Add(time.Hour)}))
+	require.Len(t, s.records, 2, "purged at most once per interval")
+
+	s.purged = time.Now().Add(-memoryPurgeInterval)
+	require.NoError(t, s.Put(ctx, &Record{Client: "c", Key: "newer", ExpiresAt: time.Now().Add(time.Hour)}))
+	require.Len(t, s.records, 2)
+	_, ok := s.records[recordKey{"c", "old"}]
+	require.False(t, ok, "expired records are removed by Put")
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	require.NoError(t, s.Put(ctx, &Record{Client: "c", Key: "old", ExpiresAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, s.Put(ctx, &Record{Client: "c", Key: "new", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	_, err := s.Get(ctx, "c", "old")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = s.Get(ctx, "other", "new")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	n, err := s.DeleteExpired(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	_, err = s.Get(ctx, "c", "new")
+	require.NoError(t, err)
+}
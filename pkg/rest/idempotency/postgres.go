@@ -0,0 +1,97 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+)
+
+// postgresStore keeps records in the idempotency_key table and serializes
+// requests through the Lock table.
+type postgresStore struct {
+	db      *postgres.DB
+	lockTTL time.Duration
+}
+
+// NewPostgresStore returns a Store backed by db. lockTTL bounds how long a
+// crashed request can keep duplicates of it waiting; it should exceed the
+// longest time a request takes to process.
+func NewPostgresStore(db *postgres.DB, lockTTL time.Duration) Store {
+	return &postgresStore{db: db, lockTTL: lockTTL}
+}
+
+// lockID derives a Lock table ID, which is limited to 100 characters, from client and key.
+func lockID(client, key string) string {
+	sum := sha256.Sum256([]byte(client + "\x00" + key))
+	return "idempotency/" + hex.EncodeToString(sum[:])
+}
+
+func (s *postgresStore) Lock(ctx context.Context, client, key string) (UnlockFn, error) {
+	// The lease outlives ctx: the lock is released even if the client went away.
+	lease, err := s.db.LockWait(ctx, lockID(client, key), s.lockTTL,
+		postgres.WithLockBackoff(20*time.Millisecond, 500*time.Millisecond))
+	if errors.Is(err, postgres.ErrAlreadyLocked) {
+		return nil, fmt.Errorf("%w: %v", ErrInProgress, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease.Unlock, nil
+}
+
+func (s *postgresStore) Get(ctx context.Context, client, key string) (*Record, error) {
+	r := &Record{Client: client, Key: key}
+	var header []byte
+	row := s.db.Pool.QueryRow(ctx, `
+		SELECT fingerprint, status_code, header, body, created_at, expires_at
+		FROM idempotency_key
+		WHERE client = $1 AND key = $2 AND expires_at > now()
+	`, client, key)
+	if err := row.Scan(&r.Fingerprint, &r.StatusCode, &header, &r.Body, &r.CreatedAt, &r.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading idempotency key: %w", err)
+	}
+	if err := json.Unmarshal(header, &r.Header); err != nil {
+		return nil, fmt.Errorf("decoding stored header: %w", err)
+	}
+	return r, nil
+}
+
+func (s *postgresStore) Put(ctx context.Context, r *Record) error {
+	header, err := json.Marshal(r.Header)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO idempotency_key (client, key, fingerprint, status_code, header, body, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (client, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = EXCLUDED.status_code,
+			header = EXCLUDED.header,
+			body = EXCLUDED.body,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_key.expires_at <= now()
+	`, r.Client, r.Key, r.Fingerprint, r.StatusCode, header, r.Body, r.CreatedAt, r.ExpiresAt); err != nil {
+		return fmt.Errorf("storing idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *postgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.db.Pool.Exec(ctx, `DELETE FROM idempotency_key WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,58 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresStore(t *testing.T) {
+	t.Parallel()
+
+	s := NewPostgresStore(postgres.NewTestDatabase(t), time.Minute)
+	ctx := context.Background()
+
+	unlock, err := s.Lock(ctx, "c", "k")
+	require.NoError(t, err)
+
+	// A duplicate waits for the lock.
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err = s.Lock(waitCtx, "c", "k")
+	require.Error(t, err)
+
+	_, err = s.Get(ctx, "c", "k")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	now := time.Now()
+	rec := &Record{
+		Client:      "c",
+		Key:         "k",
+		Fingerprint: "f",
+		StatusCode:  http.StatusCreated,
+		Header:      http.Header{"Location": {"/items/1"}},
+		Body:        []byte(`{"n":1}`),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	require.NoError(t, s.Put(ctx, rec))
+	require.NoError(t, unlock())
+
+	got, err := s.Get(ctx, "c", "k")
+	require.NoError(t, err)
+	require.Equal(t, rec.Header, got.Header)
+	require.Equal(t, rec.Body, got.Body)
+	require.Equal(t, rec.StatusCode, got.StatusCode)
+
+	unlock, err = s.Lock(ctx, "c", "k")
+	require.NoError(t, err)
+	require.NoError(t, unlock())
+
+	n, err := s.DeleteExpired(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
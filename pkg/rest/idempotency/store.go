@@ -0,0 +1,138 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Store.Get when no live record exists.
+	ErrNotFound = errors.New("idempotency record not found")
+	// ErrInProgress is returned by Store.Lock when ctx is done while another
+	// request still holds the key.
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+)
+
+// memoryPurgeInterval is how often Put of the memory store removes the
+// expired records.
+const memoryPurgeInterval = time.Minute
+
+// Record is the stored outcome of the first request made with a key.
+type Record struct {
+	Client      string
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// UnlockFn releases a lock taken by Store.Lock.
+type UnlockFn func() error
+
+// Store persists idempotency records.
+type Store interface {
+	// Lock blocks until no other request with the same client and key is in
+	// flight, or ctx is done. It returns ErrInProgress if the key is still
+	// held then.
+	Lock(ctx context.Context, client, key string) (UnlockFn, error)
+	// Get returns the unexpired record of client and key, or ErrNotFound.
+	Get(ctx context.Context, client, key string) (*Record, error)
+	// Put stores r, replacing an expired record with the same client and key.
+	Put(ctx context.Context, r *Record) error
+	// DeleteExpired removes expired records and returns how many were removed.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type recordKey struct {
+	client, key string
+}
+
+// memoryStore keeps records in memory. It suits tests and single instance deployments.
+// Put removes the expired records now and then, so that they do not pile up.
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[recordKey]*Record
+	locks   map[recordKey]chan struct{}
+	purged  time.Time
+}
+
+// NewMemoryStore returns a Store which keeps records in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		records: map[recordKey]*Record{},
+		locks:   map[recordKey]chan struct{}{},
+	}
+}
+
+func (m *memoryStore) Lock(ctx context.Context, client, key string) (UnlockFn, error) {
+	k := recordKey{client, key}
+	for {
+		m.mu.Lock()
+		held, ok := m.locks[k]
+		if !ok {
+			done := make(chan struct{})
+			m.locks[k] = done
+			m.mu.Unlock()
+			return func() error {
+				m.mu.Lock()
+				delete(m.locks, k)
+				m.mu.Unlock()
+				close(done)
+				return nil
+			}, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %v", ErrInProgress, ctx.Err())
+		}
+	}
+}
+
+func (m *memoryStore) Get(ctx context.Context, client, key string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.records[recordKey{client, key}]
+	if !ok || !r.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+func (m *memoryStore) Put(ctx context.Context, r *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now := time.Now(); now.Sub(m.purged) >= memoryPurgeInterval {
+		m.deleteExpired(now)
+	}
+	m.records[recordKey{r.Client, r.Key}] = r
+	return nil
+}
+
+func (m *memoryStore) DeleteExpired(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deleteExpired(time.Now()), nil
+}
+
+// deleteExpired removes the records expired at now. m.mu must be held.
+func (m *memoryStore) deleteExpired(now time.Time) int64 {
+	m.purged = now
+	var n int64
+	for k, r := range m.records {
+		if !r.ExpiresAt.After(now) {
+			delete(m.records, k)
+			n++
+		}
+	}
+	return n
+}
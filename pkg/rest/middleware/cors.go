@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/emicklei/go-restful"
+)
+
+//preflightMaxAge is how many seconds a browser may cache a preflight response
+const preflightMaxAge = "600"
+
+//exposedHeaders are the response headers, beyond the CORS-safelisted ones, a browser lets
+//cross-origin scripts read
+const exposedHeaders = "ETag, Link, Location, Retry-After, Idempotent-Replayed"
+
+//CORS allows cross-origin requests from a set of origins which can change while serving
+type CORS struct {
+	origins atomic.Value // []string
+}
+
+//NewCORS returns a CORS filter allowing origins. "*" allows any origin, no origin disables CORS
+func NewCORS(origins ...string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+//SetOrigins replaces the allowed origins
+func (c *CORS) SetOrigins(origins []string) {
+	c.origins.Store(append([]string(nil), origins...))
+}
+
+//Origins returns the allowed origins
+func (c *CORS) Origins() []string {
+	return c.origins.Load().([]string)
+}
+
+//Filter adds the CORS response headers when the request origin is allowed and answers
+//the preflight OPTIONS request of an allowed origin itself. Other responses to an allowed
+//origin expose the headers clients of this API read. Unless any origin is allowed
+//the response varies by origin, also when the origin is rejected
+func (c *CORS) Filter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	origins := c.Origins()
+	if len(origins) == 0 {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+	origin := req.Request.Header.Get("Origin")
+	allow := ""
+	for _, o := range origins {
+		if o == "*" {
+			allow = "*"
+			break
+		}
+		if origin != "" && o == origin {
+			allow = origin
+			break
+		}
+	}
+	if allow != "*" {
+		resp.AddHeader("Vary", "Origin")
+	}
+	if origin == "" || allow == "" {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+	resp.AddHeader("Access-Control-Allow-Origin", allow)
+
+	method := req.Request.Header.Get("Access-Control-Request-Method")
+	if req.Request.Method != http.MethodOptions || method == "" {
+		resp.AddHeader("Access-Control-Expose-Headers", exposedHeaders)
+		chain.ProcessFilter(req, resp)
+		return
+	}
+	resp.AddHeader("Access-Control-Allow-Methods", method)
+	if headers := req.Request.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		resp.AddHeader("Access-Control-Allow-Headers", headers)
+	}
+	resp.AddHeader("Access-Control-Max-Age", preflightMaxAge)
+	resp.WriteHeader(http.StatusNoContent)
+}
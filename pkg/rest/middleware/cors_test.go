@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS(t *testing.T) {
+	cors := NewCORS("https://a.example.com")
+	c := restful.NewContainer()
+	c.Filter(cors.Filter)
+	ws := new(restful.WebService)
+	ws.Route(ws.GET("/").To(func(req *restful.Request, resp *restful.Response) {}))
+	c.Add(ws)
+
+	allowed := func(origin string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	require.Equal(t, "https://a.example.com", allowed("https://a.example.com"))
+	require.Empty(t, allowed("https://b.example.com"))
+
+	cors.SetOrigins([]string{"*"})
+	require.Equal(t, "*", allowed("https://b.example.com"))
+
+	cors.SetOrigins(nil)
+	require.Empty(t, allowed("https://a.example.com"))
+}
+
+func TestCORS_Vary(t *testing.T) {
+	cors := NewCORS("https://a.example.com")
+	c := restful.NewContainer()
+	c.Filter(cors.Filter)
+	ws := new(restful.WebService)
+	ws.Route(ws.GET("/").To(func(req *restful.Request, resp *restful.Response) {}))
+	c.Add(ws)
+
+	vary := func(origin string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		return rec.Header().Get("Vary")
+	}
+
+	require.Equal(t, "Origin", vary("https://a.example.com"))
+	require.Equal(t, "Origin", vary("https://b.example.com"), "a rejected origin varies too")
+
+	cors.SetOrigins([]string{"*"})
+	require.Empty(t, vary("https://b.example.com"))
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	cors := NewCORS("https://a.example.com")
+	c := restful.NewContainer()
+	c.Filter(cors.Filter)
+	ws := new(restful.WebService)
+	ws.Route(ws.POST("/users").To(func(req *restful.Request, resp *restful.Response) {
+		t.Error("a preflight request must not reach the route")
+	}))
+	c.Add(ws)
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type, Idempotency-Key")
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://a.example.com")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "https://a.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, http.MethodPost, rec.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "Content-Type, Idempotency-Key", rec.Header().Get("Access-Control-Allow-Headers"))
+	require.NotEmpty(t, rec.Header().Get("Access-Control-Max-Age"))
+
+	require.Empty(t, rec.Header().Get("Access-Control-Expose-Headers"))
+
+	rec = preflight("https://b.example.com")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "Origin", rec.Header().Get("Vary"))
+}
+
+func TestCORS_ExposeHeaders(t *testing.T) {
+	cors := NewCORS("https://a.example.com")
+	c := restful.NewContainer()
+	c.Filter(cors.Filter)
+	ws := new(restful.WebService)
+	ws.Route(ws.POST("/users").To(func(req *restful.Request, resp *restful.Response) {
+		resp.AddHeader("Location", "/users/1")
+		resp.WriteHeader(http.StatusCreated)
+	}))
+	c.Add(ws)
+
+	exposed := func(origin string) string {
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		return rec.Header().Get("Access-Control-Expose-Headers")
+	}
+
+	require.Equal(t, "ETag, Link, Location, Retry-After, Idempotent-Replayed", exposed("https://a.example.com"))
+	require.Empty(t, exposed("https://b.example.com"))
+
+	cors.SetOrigins([]string{"*"})
+	require.Equal(t, "ETag, Link, Location, Retry-After, Idempotent-Replayed", exposed("https://b.example.com"))
+}
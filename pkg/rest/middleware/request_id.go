@@ -10,20 +10,19 @@ import (
 	"fmt"
 	"os"
 	"strings"
-)
 
-// Key to use when setting the request ID.
-type ctxKeyRequestID int
+	"github.com/jusongchen/REST-app/pkg/reqid"
+)
 
 // RequestIDKey is the key that holds the unique request ID in a request context.
-const RequestIDKey ctxKeyRequestID = 0
+const RequestIDKey = reqid.Key
 
 // RequestIDHeader is the name of the HTTP Header which contains the request id.
 // Exported so that it can be changed by developers
 var RequestIDHeader = "X-Request-Id"
 
 var prefix string
-var reqid uint64
+var reqCount uint64
 
 // A quick note on the statistics here: we're trying to calculate the chance that
 // two randomly generated base62 prefixes will collide. We use the formula from
@@ -68,7 +67,7 @@ func init() {
 // 		ctx := r.Context()
 // 		requestID := r.Header.Get(RequestIDHeader)
 // 		if requestID == "" {
-// 			myid := atomic.AddUint64(&reqid, 1)
+// 			myid := atomic.AddUint64(&reqCount, 1)
 // 			requestID = fmt.Sprintf("%s-%06d", prefix, myid)
 // 		}
 // 		ctx = context.WithValue(ctx, RequestIDKey, requestID)
@@ -80,11 +79,5 @@ func init() {
 // GetReqID returns a request ID from the given context if one is present.
 // Returns the empty string if a request ID cannot be found.
 func GetReqID(ctx context.Context) string {
-	if ctx == nil {
-		return ""
-	}
-	if reqID, ok := ctx.Value(RequestIDKey).(string); ok {
-		return reqID
-	}
-	return ""
+	return reqid.FromContext(ctx)
 }
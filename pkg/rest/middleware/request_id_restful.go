@@ -1,11 +1,11 @@
 package middleware
 
 import (
-	"context"
 	"fmt"
 	"sync/atomic"
 
 	"github.com/emicklei/go-restful"
+	"github.com/jusongchen/REST-app/pkg/reqid"
 )
 
 // RequestIDRest filter
@@ -14,10 +14,10 @@ func RequestIDRest(req *restful.Request, resp *restful.Response, chain *restful.
 	ctx := req.Request.Context()
 	requestID := req.Request.Header.Get(RequestIDHeader)
 	if requestID == "" {
-		myid := atomic.AddUint64(&reqid, 1)
+		myid := atomic.AddUint64(&reqCount, 1)
 		requestID = fmt.Sprintf("%s-%06d", prefix, myid)
 	}
-	ctx = context.WithValue(ctx, RequestIDKey, requestID)
+	ctx = reqid.NewContext(ctx, requestID)
 
 	req.Request = req.Request.WithContext(ctx)
 
@@ -0,0 +1,7 @@
+package resource
+
+import "errors"
+
+// ErrBodyTooLarge is returned by the reads of a request body beyond the size
+// limit of its route. It is answered with 413 Request Entity Too Large.
+var ErrBodyTooLarge = errors.New("http: request body too large")
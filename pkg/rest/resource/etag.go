@@ -0,0 +1,98 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AnyVersion is returned by IfMatchVersion for "If-Match: *", which matches
+// whatever version of the resource currently exists.
+const AnyVersion int64 = 0
+
+var (
+	// ErrPreconditionRequired is returned when an unsafe request lacks an If-Match header.
+	ErrPreconditionRequired = errors.New("If-Match header is required, fetch the resource to get its ETag")
+
+	// ErrInvalidIfMatch is returned when an If-Match header cannot be parsed.
+	ErrInvalidIfMatch = errors.New("If-Match header must hold a list of entity tags or *")
+)
+
+// VersionETag returns the strong entity tag of a resource version.
+func VersionETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// IfMatchVersions returns the resource versions the unsafe request r is
+// conditional on, any of which matches: AnyVersion alone for "If-Match: *",
+// otherwise the versions of the listed strong entity tags. Weak or foreign
+// entity tags can never match and are left out, so with none left the
+// caller's version check fails with 412.
+func IfMatchVersions(r *http.Request) ([]int64, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" {
+		return nil, ErrPreconditionRequired
+	}
+	if h == "*" {
+		return []int64{AnyVersion}, nil
+	}
+	versions := []int64{}
+	for h != "" {
+		weak := strings.HasPrefix(h, "W/")
+		h = strings.TrimPrefix(h, "W/")
+		if !strings.HasPrefix(h, `"`) {
+			return nil, ErrInvalidIfMatch
+		}
+		end := strings.IndexByte(h[1:], '"')
+		if end < 0 {
+			return nil, ErrInvalidIfMatch
+		}
+		tag := h[1 : end+1]
+		h = strings.TrimSpace(h[end+2:])
+		if h != "" {
+			if h[0] != ',' {
+				return nil, ErrInvalidIfMatch
+			}
+			h = strings.TrimLeft(h, ", \t")
+		}
+
+		// If-Match uses the strong comparison function, weak tags never match.
+		if weak {
+			continue
+		}
+		if v, err := strconv.ParseInt(tag, 10, 64); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// MatchesVersion reports whether version is one of versions, as returned by
+// IfMatchVersions.
+func MatchesVersion(versions []int64, version int64) bool {
+	for _, v := range versions {
+		if v == AnyVersion || v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified reports whether the If-None-Match header of r matches etag,
+// in which case a GET should be answered with 304 Not Modified.
+func NotModified(r *http.Request, etag string) bool {
+	h := r.Header.Get("If-None-Match")
+	if h == "" {
+		return false
+	}
+	for _, tag := range strings.Split(h, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-None-Match uses the weak comparison function.
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+// Package resource provides helpers shared by RESTful resources: cursor based
+// pagination, sorting, JSON merge patch and conditional requests.
+package resource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPageSize is used when a request does not specify a limit.
+	DefaultPageSize = 20
+	// MaxPageSize caps the limit a client can request.
+	MaxPageSize = 100
+
+	// LimitParam is the query parameter holding the page size.
+	LimitParam = "limit"
+	// CursorParam is the query parameter holding the opaque page cursor.
+	CursorParam = "cursor"
+	// SortParam is the query parameter holding the sort expression.
+	SortParam = "sort"
+)
+
+// Cursor marks the position of the last item of a page in a sorted listing.
+// It is handed to clients as an opaque string.
+type Cursor struct {
+	// Sort is the canonical sort expression the cursor was issued for.
+	Sort string `json:"s"`
+	// Key holds the sort key values of the last item, with its ID last.
+	Key []string `json:"k"`
+}
+
+// Encode returns the opaque string form of c.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return &c, nil
+}
+
+// Page holds the pagination parameters of a listing request.
+type Page struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// ParsePage reads the limit and cursor query parameters. The cursor must have
+// been issued for the given sort expression.
+func ParsePage(q url.Values, sort Sort) (Page, error) {
+	p := Page{Limit: DefaultPageSize}
+
+	if v := q.Get(LimitParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return p, fmt.Errorf("%s must be an integer between 1 and %d", LimitParam, MaxPageSize)
+		}
+		p.Limit = n
+	}
+
+	if v := q.Get(CursorParam); v != "" {
+		c, err := DecodeCursor(v)
+		if err != nil {
+			return p, err
+		}
+		if c.Sort != sort.String() {
+			return p, fmt.Errorf("cursor was issued for sort %q, not %q", c.Sort, sort.String())
+		}
+		p.Cursor = c
+	}
+	return p, nil
+}
+
+// SetLinks adds a Link header (RFC 8288) to h with the first page of the
+// listing requested by u and, when next is not nil, the page following it.
+func SetLinks(h http.Header, u *url.URL, limit int, next *Cursor) {
+	links := []string{link(u, limit, nil, "first")}
+	if next != nil {
+		links = append(links, link(u, limit, next, "next"))
+	}
+	h.Set("Link", strings.Join(links, ", "))
+}
+
+func link(u *url.URL, limit int, c *Cursor, rel string) string {
+	q := u.Query()
+	q.Set(LimitParam, strconv.Itoa(limit))
+	q.Del(CursorParam)
+	if c != nil {
+		q.Set(CursorParam, c.Encode())
+	}
+	target := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", target.String(), rel)
+}
@@ -0,0 +1,163 @@
+package resource
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort(t *testing.T) {
+	def := Sort{{Name: "id"}}
+	tests := []struct {
+		name    string
+		expr    string
+		want    Sort
+		wantErr bool
+	}{
+		{name: "empty_uses_default", expr: "", want: def},
+		{name: "asc_and_desc", expr: "name,-age", want: Sort{{Name: "name"}, {Name: "age", Desc: true}}},
+		{name: "explicit_asc", expr: "+age", want: Sort{{Name: "age"}}},
+		{name: "unknown_field", expr: "email", wantErr: true},
+		{name: "duplicate_field", expr: "age,-age", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSort(tt.expr, def, "id", "name", "age")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	sort := Sort{{Name: "name"}}
+	c := Cursor{Sort: sort.String(), Key: []string{"john", "42"}}
+
+	p, err := ParsePage(url.Values{}, sort)
+	require.NoError(t, err)
+	require.Equal(t, DefaultPageSize, p.Limit)
+	require.Nil(t, p.Cursor)
+
+	p, err = ParsePage(url.Values{LimitParam: {"5"}, CursorParam: {c.Encode()}}, sort)
+	require.NoError(t, err)
+	require.Equal(t, 5, p.Limit)
+	require.Equal(t, &c, p.Cursor)
+
+	for _, bad := range []url.Values{
+		{LimitParam: {"0"}},
+		{LimitParam: {"abc"}},
+		{LimitParam: {"1000"}},
+		{CursorParam: {"!!not-a-cursor"}},
+		{CursorParam: {Cursor{Sort: "-age", Key: []string{"1", "42"}}.Encode()}},
+	} {
+		_, err := ParsePage(bad, sort)
+		require.Error(t, err, "%v", bad)
+	}
+}
+
+func TestSetLinks(t *testing.T) {
+	u, _ := url.Parse("/api/v1/users/?name=john&cursor=old")
+	h := http.Header{}
+
+	SetLinks(h, u, 10, nil)
+	require.Equal(t, `</api/v1/users/?limit=10&name=john>; rel="first"`, h.Get("Link"))
+
+	next := &Cursor{Sort: "id", Key: []string{"a", "a"}}
+	SetLinks(h, u, 10, next)
+	links := strings.Split(h.Get("Link"), ", ")
+	require.Len(t, links, 2)
+	require.Contains(t, links[1], "cursor="+next.Encode())
+	require.Contains(t, links[1], `rel="next"`)
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{name: "replace", doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add", doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "remove", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "nested", doc: `{"a":{"b":"c","d":1}}`, patch: `{"a":{"d":null,"e":2}}`, want: `{"a":{"b":"c","e":2}}`},
+		{name: "array_replaced", doc: `{"a":[1,2]}`, patch: `{"a":[3]}`, want: `{"a":[3]}`},
+		{name: "non_object_patch", doc: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			require.NoError(t, err)
+			require.JSONEq(t, tt.want, string(got))
+		})
+	}
+
+	_, err := MergePatch([]byte(`{}`), []byte(`{bad`))
+	require.Error(t, err)
+}
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    []int64
+		wantErr error
+	}{
+		{header: "", wantErr: ErrPreconditionRequired},
+		{header: "*", want: []int64{AnyVersion}},
+		{header: `"7"`, want: []int64{7}},
+		{header: `W/"7"`, want: []int64{}},
+		{header: `"abc"`, want: []int64{}},
+		{header: `"1", "2"`, want: []int64{1, 2}},
+		{header: `"3",W/"4" ,"x,y", "5"`, want: []int64{3, 5}},
+		{header: `7`, wantErr: ErrInvalidIfMatch},
+		{header: `"7`, wantErr: ErrInvalidIfMatch},
+		{header: `"7" "8"`, wantErr: ErrInvalidIfMatch},
+		{header: `"7", *`, wantErr: ErrInvalidIfMatch},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(http.MethodPut, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		got, err := IfMatchVersions(r)
+		if tt.wantErr != nil {
+			require.ErrorIs(t, err, tt.wantErr, tt.header)
+			continue
+		}
+		require.NoError(t, err, tt.header)
+		require.Equal(t, tt.want, got, tt.header)
+	}
+}
+
+func TestMatchesVersion(t *testing.T) {
+	require.True(t, MatchesVersion([]int64{3, 4}, 4))
+	require.True(t, MatchesVersion([]int64{AnyVersion}, 9))
+	require.False(t, MatchesVersion([]int64{3, 4}, 5))
+	require.False(t, MatchesVersion([]int64{}, 5))
+}
+
+func TestNotModified(t *testing.T) {
+	etag := VersionETag(3)
+	for header, want := range map[string]bool{
+		"":              false,
+		`"2"`:           false,
+		`"3"`:           true,
+		`W/"3"`:         true,
+		`"1", "3"`:      true,
+		"*":             true,
+		`"1", W/"2"`:    false,
+		`"30"`:          false,
+		`W/"2", "3"   `: true,
+	} {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-None-Match", header)
+		require.Equal(t, want, NotModified(r, etag), header)
+	}
+}
@@ -0,0 +1,61 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortField is one key of a sort expression.
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// Sort is an ordered list of sort keys, e.g. parsed from "name,-age".
+type Sort []SortField
+
+// ParseSort parses a comma separated sort expression. A leading "-" sorts a
+// field in descending order, a leading "+" or no prefix in ascending order.
+// Only fields listed in allowed are accepted; an empty expression yields def.
+func ParseSort(expr string, def Sort, allowed ...string) (Sort, error) {
+	if strings.TrimSpace(expr) == "" {
+		return def, nil
+	}
+
+	var s Sort
+	seen := map[string]bool{}
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		f := SortField{Name: strings.TrimLeft(part, "+-"), Desc: strings.HasPrefix(part, "-")}
+		if !contains(allowed, f.Name) {
+			return nil, fmt.Errorf("cannot sort by %q, allowed fields: %s", f.Name, strings.Join(allowed, ", "))
+		}
+		if seen[f.Name] {
+			return nil, fmt.Errorf("sort field %q given more than once", f.Name)
+		}
+		seen[f.Name] = true
+		s = append(s, f)
+	}
+	return s, nil
+}
+
+// String returns the canonical form of s.
+func (s Sort) String() string {
+	parts := make([]string, len(s))
+	for i, f := range s {
+		parts[i] = f.Name
+		if f.Desc {
+			parts[i] = "-" + f.Name
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
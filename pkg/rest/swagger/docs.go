@@ -0,0 +1,67 @@
+package swagger
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/go-openapi/spec"
+)
+
+//Docs is the OpenAPI document served on /apidocs.json: the one built from the web services,
+//merged with the fragments documenting the handlers served next to them
+type Docs struct {
+	swagger *spec.Swagger
+}
+
+//Merge adds the paths, definitions and tags of fragment to d. It fails, leaving d as it was,
+//on a path d documents already or on a definition named as a different one of d.
+//It must not be called while d is served
+func (d *Docs) Merge(fragment *spec.Swagger) error {
+	var paths map[string]spec.PathItem
+	if fragment.Paths != nil {
+		paths = fragment.Paths.Paths
+	}
+	for _, p := range sortedPaths(paths) {
+		if _, ok := d.swagger.Paths.Paths[p]; ok {
+			return fmt.Errorf("swagger: path %s is documented already", p)
+		}
+	}
+	for name, def := range fragment.Definitions {
+		if old, ok := d.swagger.Definitions[name]; ok && !reflect.DeepEqual(old, def) {
+			return fmt.Errorf("swagger: definition %s differs from the one documented already", name)
+		}
+	}
+
+	for p, item := range paths {
+		d.swagger.Paths.Paths[p] = item
+	}
+	for name, def := range fragment.Definitions {
+		d.swagger.Definitions[name] = def
+	}
+	for _, tag := range fragment.Tags {
+		if !hasTag(d.swagger.Tags, tag.Name) {
+			d.swagger.Tags = append(d.swagger.Tags, tag)
+		}
+	}
+	return nil
+}
+
+//sortedPaths returns the paths of paths in order
+func sortedPaths(paths map[string]spec.PathItem) []string {
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func hasTag(tags []spec.Tag, name string) bool {
+	for _, t := range tags {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
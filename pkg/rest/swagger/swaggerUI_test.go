@@ -92,7 +92,7 @@ func newSwaggerTestHTTPServer(t *testing.T) *httptest.Server {
 
 	u := UserResource{map[string]User{}}
 
-	c, err := NewContainer(nil, ts.URL, swaggerUIPath, info, u.WebService())
+	c, err := NewContainer(ts.URL, swaggerUIPath, info, u.WebService())
 	require.NoError(t, err)
 	httpSrv := ts.Config
 	httpSrv.Handler = c
@@ -30,19 +30,33 @@ type ServerInfo struct {
 
 //NewContainer returns a restful.Container with swagger handled
 func NewContainer(webServicesURL, swaggerUIPath string, info ServerInfo, ws ...*restful.WebService) (*restful.Container, error) {
+	c, _, err := NewContainerWithDocs(webServicesURL, swaggerUIPath, info, ws...)
+	return c, err
+}
+
+//NewContainerWithDocs returns a restful.Container with swagger handled, and its OpenAPI
+//document, to which the handlers served next to the web services add theirs
+func NewContainerWithDocs(webServicesURL, swaggerUIPath string, info ServerInfo, ws ...*restful.WebService) (*restful.Container, *Docs, error) {
 
 	if _, err := os.Stat(swaggerUIPath); os.IsNotExist(err) {
 
-		return nil, fmt.Errorf("sawgger.NewContainer:swaggerUIPath does not exist:%s", swaggerUIPath)
+		return nil, nil, fmt.Errorf("sawgger.NewContainer:swaggerUIPath does not exist:%s", swaggerUIPath)
 	}
 	c := restful.NewContainer()
-	spec := buildConfig(c, webServicesURL, info, ws)
+	config := buildConfig(c, webServicesURL, info, ws)
+	docs := &Docs{}
+	postBuild := config.PostBuildSwaggerObjectHandler
+	config.PostBuildSwaggerObjectHandler = func(swo *spec.Swagger) {
+		postBuild(swo)
+		// the OpenAPI service serves swo as is
+		docs.swagger = swo
+	}
 	// Swagger WebUI
-	c.Add(restfulspec.NewOpenAPIService(*spec))
+	c.Add(restfulspec.NewOpenAPIService(*config))
 	c.Handle(swaggerUIHomeURL, handleSwaggerHomeUI())
 	c.Handle(swaggerUIAPIDocURL, handleSwagger(swaggerUIPath))
 
-	return c, nil
+	return c, docs, nil
 }
 
 func handleSwagger(swaggerUIPath string) http.HandlerFunc {
@@ -0,0 +1,195 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// entry is a task with the bookkeeping of the worker running it.
+type entry struct {
+	Task
+	worker    string
+	heartbeat time.Time
+	runAfter  time.Time
+}
+
+// memoryStore keeps tasks in memory. It is used when no database is configured.
+type memoryStore struct {
+	mu    sync.Mutex
+	tasks map[string]*entry
+}
+
+// NewMemoryStore returns a Queue which keeps tasks in memory.
+func NewMemoryStore() Queue {
+	return &memoryStore{tasks: map[string]*entry{}}
+}
+
+func (m *memoryStore) Create(ctx context.Context, taskType string, payload json.RawMessage) (*Task, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	e := &entry{
+		Task:     Task{ID: id, Type: taskType, Status: Queued, Payload: payload, SubmittedAt: now, UpdatedAt: now},
+		runAfter: now,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks[id] = e
+	c := e.Task
+	return &c, nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, id string) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := e.Task
+	return &c, nil
+}
+
+// transition moves task id to state to, calling update on it under the lock.
+func (m *memoryStore) transition(id string, to Status, update func(e *entry)) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := checkTransition(id, e.Status, to); err != nil {
+		return nil, err
+	}
+	apply(&e.Task, to, time.Now())
+	e.worker = ""
+	if update != nil {
+		update(e)
+	}
+	c := e.Task
+	return &c, nil
+}
+
+func (m *memoryStore) Start(ctx context.Context, id string) (*Task, error) {
+	return m.transition(id, Running, nil)
+}
+
+func (m *memoryStore) Succeed(ctx context.Context, id string, result json.RawMessage) (*Task, error) {
+	return m.transition(id, Succeeded, func(e *entry) { e.Result = result })
+}
+
+func (m *memoryStore) Fail(ctx context.Context, id string, cause error) (*Task, error) {
+	return m.transition(id, Failed, func(e *entry) { e.Error = cause.Error() })
+}
+
+func (m *memoryStore) Cancel(ctx context.Context, id string) (*Task, error) {
+	return m.transition(id, Cancelled, nil)
+}
+
+func (m *memoryStore) Claim(ctx context.Context, worker string, types []string) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var ready []*entry
+	for _, e := range m.tasks {
+		if e.Status == Queued && !e.runAfter.After(now) && contains(types, e.Type) {
+			ready = append(ready, e)
+		}
+	}
+	if len(ready) == 0 {
+		return nil, ErrNoTask
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		if !ready[i].runAfter.Equal(ready[j].runAfter) {
+			return ready[i].runAfter.Before(ready[j].runAfter)
+		}
+		return ready[i].SubmittedAt.Before(ready[j].SubmittedAt)
+	})
+
+	e := ready[0]
+	apply(&e.Task, Running, now)
+	e.worker, e.heartbeat = worker, now
+	c := e.Task
+	return &c, nil
+}
+
+// owned returns task id if it is running for worker. It must be called with the lock held.
+func (m *memoryStore) owned(id, worker string) (*entry, error) {
+	e, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if e.Status != Running || e.worker != worker {
+		return nil, ErrLeaseLost
+	}
+	return e, nil
+}
+
+func (m *memoryStore) Heartbeat(ctx context.Context, id, worker string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.owned(id, worker)
+	if err != nil {
+		return err
+	}
+	e.heartbeat = time.Now()
+	return nil
+}
+
+func (m *memoryStore) Release(ctx context.Context, id, worker string, o Outcome) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.owned(id, worker)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransition(id, e.Status, o.Status); err != nil {
+		return nil, err
+	}
+	apply(&e.Task, o.Status, time.Now())
+	e.worker = ""
+	e.Result, e.Error = o.Result, o.Error
+	if o.Status == Queued {
+		e.runAfter = o.RetryAt
+	}
+	c := e.Task
+	return &c, nil
+}
+
+func (m *memoryStore) Requeue(ctx context.Context, timeout time.Duration, maxAttempts int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, e := range m.tasks {
+		if e.Status != Running || e.heartbeat.IsZero() || now.Sub(e.heartbeat) <= timeout {
+			continue
+		}
+		to := Queued
+		if e.Attempts >= maxAttempts {
+			to = Dead
+		}
+		apply(&e.Task, to, now)
+		e.worker, e.heartbeat, e.runAfter = "", time.Time{}, now
+		e.Error = lostHeartbeat
+		n++
+	}
+	return n, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,380 @@
+package task
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jusongchen/REST-app/pkg/config"
+	"github.com/jusongchen/REST-app/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Handler runs tasks of one type.
+type Handler interface {
+	// Run does the work of t and returns its result. A failed attempt is
+	// retried with backoff unless the error is wrapped with Permanent. ctx is
+	// cancelled when the task is cancelled, the worker loses its lease or the
+	// pool stops.
+	Run(ctx context.Context, t *Task) (json.RawMessage, error)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, t *Task) (json.RawMessage, error)
+
+// Run calls f(ctx, t).
+func (f HandlerFunc) Run(ctx context.Context, t *Task) (json.RawMessage, error) {
+	return f(ctx, t)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the task fails at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Config tunes a Pool.
+type Config struct {
+	// Concurrency is the number of tasks the pool runs at the same time.
+	Concurrency int `env:"TASK_CONCURRENCY, default=4" json:"concurrency,omitempty" info:"true"`
+	// PollInterval is how long an idle pool waits before looking for tasks again.
+	PollInterval time.Duration `env:"TASK_POLL_INTERVAL, default=1s" json:"poll_interval,omitempty" info:"true"`
+	// HeartbeatInterval is how often a worker tells it still runs a task.
+	HeartbeatInterval time.Duration `env:"TASK_HEARTBEAT_INTERVAL, default=10s" json:"heartbeat_interval,omitempty" info:"true"`
+	// VisibilityTimeout is how long a running task can go without heartbeat
+	// before it is considered abandoned and re-queued.
+	VisibilityTimeout time.Duration `env:"TASK_VISIBILITY_TIMEOUT, default=1m" json:"visibility_timeout,omitempty" info:"true"`
+	// MaxAttempts is how many times a task is run before it is dead-lettered.
+	MaxAttempts int `env:"TASK_MAX_ATTEMPTS, default=5" json:"max_attempts,omitempty" info:"true"`
+	// RetryBackoff is the delay before the first retry; it doubles with each
+	// attempt up to MaxRetryBackoff.
+	RetryBackoff    time.Duration `env:"TASK_RETRY_BACKOFF, default=5s" json:"retry_backoff,omitempty" info:"true"`
+	MaxRetryBackoff time.Duration `env:"TASK_MAX_RETRY_BACKOFF, default=10m" json:"max_retry_backoff,omitempty" info:"true"`
+}
+
+// Validate checks the settings of c. Zero settings take their default.
+func (c Config) Validate() error {
+	var errs config.Errors
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"TASK_POLL_INTERVAL", c.PollInterval},
+		{"TASK_HEARTBEAT_INTERVAL", c.HeartbeatInterval},
+		{"TASK_VISIBILITY_TIMEOUT", c.VisibilityTimeout},
+		{"TASK_RETRY_BACKOFF", c.RetryBackoff},
+		{"TASK_MAX_RETRY_BACKOFF", c.MaxRetryBackoff},
+	} {
+		if d.value < 0 {
+			errs.Add(fmt.Errorf("%s must not be negative, got %v", d.name, d.value))
+		}
+	}
+	if c.Concurrency < 0 {
+		errs.Add(fmt.Errorf("TASK_CONCURRENCY must not be negative, got %d", c.Concurrency))
+	}
+	if c.MaxAttempts < 0 {
+		errs.Add(fmt.Errorf("TASK_MAX_ATTEMPTS must not be negative, got %d", c.MaxAttempts))
+	}
+	if c.HeartbeatInterval > 0 && c.VisibilityTimeout > 0 && c.HeartbeatInterval >= c.VisibilityTimeout {
+		errs.Add(fmt.Errorf("TASK_HEARTBEAT_INTERVAL %v must be shorter than TASK_VISIBILITY_TIMEOUT %v", c.HeartbeatInterval, c.VisibilityTimeout))
+	}
+	return errs.Err()
+}
+
+// withDefaults fills the zero fields of c.
+func (c Config) withDefaults() Config {
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = time.Minute
+	}
+	if c.HeartbeatInterval <= 0 {
+		c.HeartbeatInterval = c.VisibilityTimeout / 6
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 5 * time.Second
+	}
+	if c.MaxRetryBackoff < c.RetryBackoff {
+		c.MaxRetryBackoff = c.RetryBackoff
+	}
+	return c
+}
+
+// backoff returns the delay before retrying a task that failed attempts times.
+func (c Config) backoff(attempts int) time.Duration {
+	d := c.RetryBackoff
+	for i := 1; i < attempts && d < c.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxRetryBackoff {
+		d = c.MaxRetryBackoff
+	}
+	return d
+}
+
+// Pool runs queued tasks with the handler registered for their type. Several
+// pools, in the same or different processes, can share a Queue.
+type Pool struct {
+	queue    Queue
+	conf     Config
+	worker   string
+	handlers map[string]Handler
+	logger   *zap.SugaredLogger
+
+	mu      sync.Mutex
+	stop    context.CancelFunc // stops claiming tasks
+	abort   context.CancelFunc // cancels running handlers
+	running context.Context    // parent of the handler contexts
+	wg      sync.WaitGroup
+}
+
+// NewPool returns a stopped Pool taking tasks from q.
+func NewPool(q Queue, conf Config) *Pool {
+	return &Pool{
+		queue:    q,
+		conf:     conf.withDefaults(),
+		worker:   workerName(),
+		handlers: map[string]Handler{},
+		logger:   logging.DefaultLogger().Named("task.Pool"),
+	}
+}
+
+// workerName identifies the pool to the Queue.
+func workerName() string {
+	host, _ := os.Hostname()
+	var b [4]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b[:]))
+}
+
+// Register makes the pool run tasks of taskType with h. It must be called before Start.
+func (p *Pool) Register(taskType string, h Handler) {
+	p.handlers[taskType] = h
+}
+
+// Types returns the task types the pool has handlers for, sorted.
+func (p *Pool) Types() []string {
+	types := make([]string, 0, len(p.handlers))
+	for t := range p.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Start starts claiming and running tasks in the background.
+func (p *Pool) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return errors.New("task pool already started")
+	}
+	if len(p.handlers) == 0 {
+		return errors.New("task pool has no handler registered")
+	}
+	if p.conf.HeartbeatInterval >= p.conf.VisibilityTimeout {
+		return fmt.Errorf("task heartbeat interval %v must be shorter than the visibility timeout %v",
+			p.conf.HeartbeatInterval, p.conf.VisibilityTimeout)
+	}
+
+	var ctx context.Context
+	ctx, p.stop = context.WithCancel(context.Background())
+	p.running, p.abort = context.WithCancel(context.Background())
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		p.dispatch(ctx)
+	}()
+	go func() {
+		defer p.wg.Done()
+		p.reap(ctx)
+	}()
+	p.logger.Infof("worker %s runs up to %d tasks of types %v", p.worker, p.conf.Concurrency, p.Types())
+	return nil
+}
+
+// Stop stops claiming tasks and waits for the running ones to finish. When ctx
+// is done first, the handlers still running are cancelled and their tasks are
+// re-queued; the interrupted attempt still counts towards MaxAttempts.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	stop, abort := p.stop, p.abort
+	p.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	stop()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		abort()
+		return nil
+	case <-ctx.Done():
+		p.logger.Warnf("stop: %v, cancelling running tasks", ctx.Err())
+		abort()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// dispatch claims tasks while a slot is free, until ctx is done.
+func (p *Pool) dispatch(ctx context.Context) {
+	types := p.Types()
+	slots := make(chan struct{}, p.conf.Concurrency)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		t, err := p.queue.Claim(ctx, p.worker, types)
+		if err != nil {
+			<-slots
+			if !errors.Is(err, ErrNoTask) && ctx.Err() == nil {
+				p.logger.Errorf("claim: %v", err)
+			}
+			select {
+			case <-time.After(p.conf.PollInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer func() { <-slots }()
+			p.run(t)
+		}()
+	}
+}
+
+// reap re-queues the tasks of workers which stopped sending heartbeats, until ctx is done.
+func (p *Pool) reap(ctx context.Context) {
+	ticker := time.NewTicker(p.conf.VisibilityTimeout / 2)
+	defer ticker.Stop()
+	for {
+		n, err := p.queue.Requeue(ctx, p.conf.VisibilityTimeout, p.conf.MaxAttempts)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			p.logger.Errorf("requeue: %v", err)
+		case n > 0:
+			p.logger.Warnf("re-queued %d abandoned tasks", n)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run runs t with its handler while sending heartbeats, then records the outcome.
+func (p *Pool) run(t *Task) {
+	ctx, cancel := context.WithCancel(p.running)
+	beating := make(chan struct{})
+	go func() {
+		defer close(beating)
+		p.heartbeat(ctx, t.ID, cancel)
+	}()
+
+	result, err := p.call(ctx, t)
+	cancel()
+	<-beating
+
+	o := p.outcome(t, result, err)
+	// The handler context may be cancelled already; the outcome must be recorded anyway.
+	if _, err := p.queue.Release(context.Background(), t.ID, p.worker, o); err != nil {
+		if errors.Is(err, ErrLeaseLost) {
+			p.logger.Infof("task %s was cancelled or re-queued while running, dropping its %s outcome", t.ID, o.Status)
+			return
+		}
+		p.logger.Errorf("release task %s: %v", t.ID, err)
+		return
+	}
+	if o.Status == Queued {
+		p.logger.Infof("task %s attempt %d failed, retrying at %v: %s", t.ID, t.Attempts, o.RetryAt, o.Error)
+	}
+}
+
+// call runs the handler of t, turning a panic into an error.
+func (p *Pool) call(ctx context.Context, t *Task) (result json.RawMessage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return p.handlers[t.Type].Run(ctx, t)
+}
+
+// heartbeat keeps the lease of the worker on task id until ctx is done. It
+// calls cancel when the lease is lost.
+func (p *Pool) heartbeat(ctx context.Context, id string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(p.conf.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		err := p.queue.Heartbeat(ctx, id, p.worker)
+		switch {
+		case errors.Is(err, ErrLeaseLost), errors.Is(err, ErrNotFound):
+			p.logger.Infof("task %s: %v, cancelling its handler", id, err)
+			cancel()
+			return
+		case err != nil && ctx.Err() == nil:
+			p.logger.Errorf("task %s heartbeat: %v", id, err)
+		}
+	}
+}
+
+// outcome decides what happens to t after an attempt returned result and err.
+func (p *Pool) outcome(t *Task, result json.RawMessage, err error) Outcome {
+	var permanent permanentError
+	switch {
+	case err == nil:
+		return Outcome{Status: Succeeded, Result: result}
+	case p.running.Err() != nil:
+		return Outcome{Status: Queued, Error: "worker stopped: " + err.Error(), RetryAt: time.Now()}
+	case errors.As(err, &permanent):
+		return Outcome{Status: Failed, Error: err.Error()}
+	case t.Attempts >= p.conf.MaxAttempts:
+		return Outcome{Status: Dead, Error: err.Error()}
+	default:
+		return Outcome{Status: Queued, Error: err.Error(), RetryAt: time.Now().Add(p.conf.backoff(t.Attempts))}
+	}
+}
@@ -0,0 +1,160 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig makes a pool react within milliseconds.
+var testConfig = Config{
+	Concurrency:       2,
+	PollInterval:      5 * time.Millisecond,
+	HeartbeatInterval: 5 * time.Millisecond,
+	VisibilityTimeout: time.Second,
+	MaxAttempts:       3,
+	RetryBackoff:      time.Millisecond,
+	MaxRetryBackoff:   time.Millisecond,
+}
+
+// waitFor polls task id until it reaches a final state.
+func waitFor(t *testing.T, q Queue, id string) *Task {
+	t.Helper()
+	var got *Task
+	require.Eventually(t, func() bool {
+		var err error
+		got, err = q.Get(context.Background(), id)
+		require.NoError(t, err)
+		return got.Status.Final()
+	}, 5*time.Second, 5*time.Millisecond)
+	return got
+}
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryStore()
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	p := NewPool(q, testConfig)
+	p.Register("flaky", HandlerFunc(func(ctx context.Context, t *Task) (json.RawMessage, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[t.ID]++
+		if calls[t.ID] < 2 {
+			return nil, errors.New("try again")
+		}
+		return json.RawMessage(`{"ok":true}`), nil
+	}))
+	p.Register("broken", HandlerFunc(func(ctx context.Context, t *Task) (json.RawMessage, error) {
+		return nil, errors.New("always failing")
+	}))
+	p.Register("invalid", HandlerFunc(func(ctx context.Context, t *Task) (json.RawMessage, error) {
+		return nil, Permanent(errors.New("bad payload"))
+	}))
+	p.Register("panicking", HandlerFunc(func(ctx context.Context, t *Task) (json.RawMessage, error) {
+		panic("oops")
+	}))
+	require.Equal(t, []string{"broken", "flaky", "invalid", "panicking"}, p.Types())
+
+	require.NoError(t, p.Start())
+	require.Error(t, p.Start())
+	defer p.Stop(ctx)
+
+	flaky, err := q.Create(ctx, "flaky", nil)
+	require.NoError(t, err)
+	broken, err := q.Create(ctx, "broken", nil)
+	require.NoError(t, err)
+	invalid, err := q.Create(ctx, "invalid", nil)
+	require.NoError(t, err)
+	panicking, err := q.Create(ctx, "panicking", nil)
+	require.NoError(t, err)
+
+	got := waitFor(t, q, flaky.ID)
+	require.Equal(t, Succeeded, got.Status)
+	require.Equal(t, 2, got.Attempts)
+	require.JSONEq(t, `{"ok":true}`, string(got.Result))
+
+	got = waitFor(t, q, broken.ID)
+	require.Equal(t, Dead, got.Status)
+	require.Equal(t, testConfig.MaxAttempts, got.Attempts)
+	require.Equal(t, "always failing", got.Error)
+
+	got = waitFor(t, q, invalid.ID)
+	require.Equal(t, Failed, got.Status)
+	require.Equal(t, 1, got.Attempts)
+
+	got = waitFor(t, q, panicking.ID)
+	require.Equal(t, Dead, got.Status)
+	require.Contains(t, got.Error, "oops")
+}
+
+func TestPool_CancelRunningTask(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryStore()
+
+	started := make(chan struct{})
+	p := NewPool(q, testConfig)
+	p.Register("slow", HandlerFunc(func(ctx context.Context, t *Task) (json.RawMessage, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	require.NoError(t, p.Start())
+	defer p.Stop(ctx)
+
+	slow, err := q.Create(ctx, "slow", nil)
+	require.NoError(t, err)
+	<-started
+	_, err = q.Cancel(ctx, slow.ID)
+	require.NoError(t, err)
+
+	// The next heartbeat finds out the task was cancelled and stops the handler.
+	got := waitFor(t, q, slow.ID)
+	require.Equal(t, Cancelled, got.Status)
+}
+
+func TestPool_Stop(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryStore()
+
+	started := make(chan struct{})
+	p := NewPool(q, testConfig)
+	p.Register("slow", HandlerFunc(func(ctx context.Context, t *Task) (json.RawMessage, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	require.NoError(t, p.Start())
+
+	slow, err := q.Create(ctx, "slow", nil)
+	require.NoError(t, err)
+	<-started
+
+	stopCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Stop(stopCtx), context.DeadlineExceeded)
+
+	got, err := q.Get(ctx, slow.ID)
+	require.NoError(t, err)
+	require.Equal(t, Queued, got.Status, "a task interrupted by Stop is re-queued")
+	require.Contains(t, got.Error, "worker stopped")
+}
+
+func TestConfigBackoff(t *testing.T) {
+	c := Config{RetryBackoff: time.Second, MaxRetryBackoff: 5 * time.Second}
+	for attempts, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+		9: 5 * time.Second,
+	} {
+		require.Equal(t, want, c.backoff(attempts), attempts)
+	}
+}
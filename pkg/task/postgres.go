@@ -0,0 +1,207 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pgx "github.com/jackc/pgx/v4"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+)
+
+const taskColumns = `task_id, type, status, payload, result, error, attempts, submitted_at, started_at, finished_at, updated_at`
+
+// postgresStore keeps tasks in the task table.
+type postgresStore struct {
+	db *postgres.DB
+}
+
+// NewPostgresStore returns a Queue backed by db.
+func NewPostgresStore(db *postgres.DB) Queue {
+	return &postgresStore{db: db}
+}
+
+func scanTask(row pgx.Row) (*Task, error) {
+	var t Task
+	var status string
+	// Scanned as []byte, SQL NULL stays empty instead of becoming "null".
+	var payload, result []byte
+	if err := row.Scan(&t.ID, &t.Type, &status, &payload, &result, &t.Error, &t.Attempts,
+		&t.SubmittedAt, &t.StartedAt, &t.FinishedAt, &t.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	t.Status = Status(status)
+	t.Payload, t.Result = payload, result
+	return &t, nil
+}
+
+func (s *postgresStore) Create(ctx context.Context, taskType string, payload json.RawMessage) (*Task, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO task (task_id, type, status, payload, submitted_at, updated_at)
+		VALUES ($1, $2, $3, $4, now(), now())
+		RETURNING `+taskColumns, id, taskType, string(Queued), nullJSON(payload))
+	t, err := scanTask(row)
+	if err != nil {
+		return nil, fmt.Errorf("creating task: %w", postgres.Classify(err))
+	}
+	return t, nil
+}
+
+func (s *postgresStore) Get(ctx context.Context, id string) (*Task, error) {
+	row := s.db.Pool.QueryRow(ctx, `SELECT `+taskColumns+` FROM task WHERE task_id = $1`, id)
+	t, err := scanTask(row)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("reading task %s: %w", id, postgres.Classify(err))
+	}
+	return t, err
+}
+
+// transition moves task id to state to inside a transaction holding the row
+// lock, setting the extra columns in set, e.g. "result = $3", to args. If
+// worker is not empty, the task must be running for it.
+func (s *postgresStore) transition(ctx context.Context, id, worker string, to Status, set string, args ...interface{}) (*Task, error) {
+	var t *Task
+	err := s.db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		var from, owner string
+		row := tx.QueryRow(ctx, `SELECT status, worker FROM task WHERE task_id = $1 FOR UPDATE`, id)
+		if err := row.Scan(&from, &owner); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if worker != "" && (Status(from) != Running || owner != worker) {
+			return ErrLeaseLost
+		}
+		if err := checkTransition(id, Status(from), to); err != nil {
+			return err
+		}
+
+		var err error
+		t, err = scanTask(tx.QueryRow(ctx, updateSQL(to, set), append([]interface{}{id, string(to)}, args...)...))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// updateSQL returns the statement moving task $1 to state $2, setting the
+// extra columns in set. Leaving running clears the worker owning the task.
+func updateSQL(to Status, set string) string {
+	sql := `UPDATE task SET status = $2, updated_at = now()`
+	if to == Running {
+		sql += `, started_at = now(), attempts = attempts + 1`
+	} else {
+		sql += `, worker = '', heartbeat_at = NULL`
+	}
+	if to.Final() {
+		sql += `, finished_at = now()`
+	}
+	if set != "" {
+		sql += ", " + set
+	}
+	return sql + ` WHERE task_id = $1 RETURNING ` + taskColumns
+}
+
+func (s *postgresStore) Start(ctx context.Context, id string) (*Task, error) {
+	return s.transition(ctx, id, "", Running, "")
+}
+
+func (s *postgresStore) Succeed(ctx context.Context, id string, result json.RawMessage) (*Task, error) {
+	return s.transition(ctx, id, "", Succeeded, "result = $3", nullJSON(result))
+}
+
+func (s *postgresStore) Fail(ctx context.Context, id string, cause error) (*Task, error) {
+	return s.transition(ctx, id, "", Failed, "error = $3", cause.Error())
+}
+
+func (s *postgresStore) Cancel(ctx context.Context, id string) (*Task, error) {
+	return s.transition(ctx, id, "", Cancelled, "")
+}
+
+func (s *postgresStore) Claim(ctx context.Context, worker string, types []string) (*Task, error) {
+	var t *Task
+	err := s.db.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		// SKIP LOCKED lets concurrent workers claim different tasks instead
+		// of queueing up behind the same row.
+		var id string
+		row := tx.QueryRow(ctx, `
+			SELECT task_id FROM task
+			WHERE status = $1 AND run_after <= now() AND type = ANY($2)
+			ORDER BY run_after, submitted_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`, string(Queued), types)
+		if err := row.Scan(&id); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNoTask
+			}
+			return err
+		}
+
+		var err error
+		t, err = scanTask(tx.QueryRow(ctx, updateSQL(Running, "worker = $3, heartbeat_at = now()"), id, string(Running), worker))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrNoTask) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("claiming task: %w", postgres.Classify(err))
+	}
+	return t, nil
+}
+
+func (s *postgresStore) Heartbeat(ctx context.Context, id, worker string) error {
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE task SET heartbeat_at = now()
+		WHERE task_id = $1 AND status = $2 AND worker = $3`, id, string(Running), worker)
+	if err != nil {
+		return fmt.Errorf("task %s heartbeat: %w", id, postgres.Classify(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *postgresStore) Release(ctx context.Context, id, worker string, o Outcome) (*Task, error) {
+	runAfter := o.RetryAt
+	if runAfter.IsZero() {
+		runAfter = time.Now()
+	}
+	return s.transition(ctx, id, worker, o.Status, "result = $3, error = $4, run_after = $5",
+		nullJSON(o.Result), o.Error, runAfter)
+}
+
+func (s *postgresStore) Requeue(ctx context.Context, timeout time.Duration, maxAttempts int) (int, error) {
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE task SET
+			status = CASE WHEN attempts >= $3 THEN $5 ELSE $4 END,
+			finished_at = CASE WHEN attempts >= $3 THEN now() END,
+			error = $6, worker = '', heartbeat_at = NULL, run_after = now(), updated_at = now()
+		WHERE status = $1 AND heartbeat_at < now() - make_interval(secs => $2)`,
+		string(Running), timeout.Seconds(), maxAttempts, string(Queued), string(Dead), lostHeartbeat)
+	if err != nil {
+		return 0, fmt.Errorf("re-queueing tasks: %w", postgres.Classify(err))
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// nullJSON maps an empty document to SQL NULL.
+func nullJSON(doc json.RawMessage) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return string(doc)
+}
@@ -0,0 +1,19 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/jusongchen/REST-app/pkg/postgres"
+)
+
+func TestPostgresStore(t *testing.T) {
+	t.Parallel()
+
+	testStoreTransitions(t, NewPostgresStore(postgres.NewTestDatabase(t)))
+}
+
+func TestPostgresQueue(t *testing.T) {
+	t.Parallel()
+
+	testQueue(t, NewPostgresStore(postgres.NewTestDatabase(t)))
+}
@@ -0,0 +1,205 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	restfulspec "github.com/emicklei/go-restful-openapi"
+	"github.com/jusongchen/REST-app/pkg/postgres"
+	"github.com/jusongchen/REST-app/pkg/rest/idempotency"
+	"github.com/jusongchen/REST-app/pkg/rest/middleware"
+)
+
+const (
+	// ResourceRootPath is where the task API is mounted.
+	ResourceRootPath = "/api/v1/tasks"
+
+	// pollInterval is suggested to clients, in seconds, through Retry-After.
+	pollInterval = 2
+)
+
+// SubmitRequest is the body of a task submission.
+type SubmitRequest struct {
+	Type    string          `json:"type" description:"kind of work to run"`
+	Payload json.RawMessage `json:"payload,omitempty" description:"input of the task, passed to its handler"`
+}
+
+// Resource is the REST layer of tasks.
+type Resource struct {
+	store Store
+	keys  idempotency.Store
+	types []string
+}
+
+// NewResource returns a Resource backed by store which accepts tasks of the
+// given types. Submissions with an Idempotency-Key header are deduplicated
+// through keys unless it is nil.
+func NewResource(store Store, keys idempotency.Store, types ...string) *Resource {
+	types = append([]string{}, types...)
+	sort.Strings(types)
+	return &Resource{store: store, keys: keys, types: types}
+}
+
+// WebService creates a new service that can handle REST requests for tasks.
+func (r *Resource) WebService() *restful.WebService {
+	ws := new(restful.WebService)
+	ws.
+		Path(ResourceRootPath).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	ws.Filter(middleware.RequestIDRest)
+	ws.Filter(middleware.Logging)
+	if r.keys != nil {
+		ws.Filter(idempotency.Filter(r.keys))
+	}
+
+	tags := []string{"tasks"}
+	taskID := ws.PathParameter("task-id", "identifier of the task").DataType("string")
+	pollHeaders := map[string]restful.Header{
+		"Retry-After": {Items: &restful.Items{Type: "integer"}, Description: "seconds to wait before polling again"},
+	}
+
+	ws.Route(ws.POST("/").To(r.submit).
+		Doc("submit a task").
+		Notes("Accepted tasks of type: "+strings.Join(r.types, ", ")+". The Location header of the response is the URL to poll.").
+		Param(ws.HeaderParameter(idempotency.KeyHeader, "client chosen unique key; a retried submission with the same key gets the original response").DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Reads(SubmitRequest{}).
+		Writes(Task{}).
+		ReturnsWithHeaders(202, "Accepted", Task{}, map[string]restful.Header{
+			"Location": {Items: &restful.Items{Type: "string"}, Description: "URL of the task"},
+		}).
+		Returns(400, "Bad Request", nil).
+		Returns(422, "Idempotency-Key reused for a different request", nil))
+
+	ws.Route(ws.GET("/{task-id}").To(r.get).
+		Doc("get the status of a task").
+		Param(taskID).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(Task{}).
+		ReturnsWithHeaders(200, "OK", Task{}, pollHeaders).
+		Returns(404, "Not Found", nil))
+
+	ws.Route(ws.GET("/{task-id}/result").To(r.result).
+		Doc("get the result of a task").
+		Notes("Returns the result of a succeeded task, 202 with the task while it is queued or running, and 409 with the task if it failed, was cancelled or ran out of attempts.").
+		Param(taskID).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(200, "OK", nil).
+		ReturnsWithHeaders(202, "Accepted, not finished yet", Task{}, pollHeaders).
+		Returns(404, "Not Found", nil).
+		Returns(409, "Conflict, the task failed, was cancelled or is dead", Task{}))
+
+	ws.Route(ws.POST("/{task-id}/cancel").To(r.cancel).
+		Doc("cancel a task").
+		Param(taskID).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(Task{}).
+		Returns(200, "OK", Task{}).
+		Returns(404, "Not Found", nil).
+		Returns(409, "Conflict, the task already finished", nil))
+
+	return ws
+}
+
+func (r *Resource) accepts(taskType string) bool {
+	i := sort.SearchStrings(r.types, taskType)
+	return i < len(r.types) && r.types[i] == taskType
+}
+
+// POST http://localhost:8080/api/v1/tasks/
+// {"type":"awr_report","payload":{"db":"orcl"}}
+//
+func (r *Resource) submit(request *restful.Request, response *restful.Response) {
+	sub := SubmitRequest{}
+	if err := request.ReadEntity(&sub); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !r.accepts(sub.Type) {
+		response.WriteErrorString(http.StatusBadRequest, "unknown task type "+strconv.Quote(sub.Type)+", accepted types: "+strings.Join(r.types, ", "))
+		return
+	}
+
+	t, err := r.store.Create(request.Request.Context(), sub.Type, sub.Payload)
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	response.AddHeader("Location", ResourceRootPath+"/"+t.ID)
+	response.AddHeader("Retry-After", strconv.Itoa(pollInterval))
+	response.WriteHeaderAndEntity(http.StatusAccepted, t)
+}
+
+// GET http://localhost:8080/api/v1/tasks/1
+//
+func (r *Resource) get(request *restful.Request, response *restful.Response) {
+	t, err := r.store.Get(request.Request.Context(), request.PathParameter("task-id"))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	if !t.Status.Final() {
+		response.AddHeader("Retry-After", strconv.Itoa(pollInterval))
+	}
+	response.WriteEntity(t)
+}
+
+// GET http://localhost:8080/api/v1/tasks/1/result
+//
+func (r *Resource) result(request *restful.Request, response *restful.Response) {
+	t, err := r.store.Get(request.Request.Context(), request.PathParameter("task-id"))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+
+	switch t.Status {
+	case Succeeded:
+		response.AddHeader("Content-Type", restful.MIME_JSON)
+		response.WriteHeader(http.StatusOK)
+		if len(t.Result) == 0 {
+			response.Write([]byte("null"))
+			return
+		}
+		response.Write(t.Result)
+	case Queued, Running:
+		response.AddHeader("Retry-After", strconv.Itoa(pollInterval))
+		response.WriteHeaderAndEntity(http.StatusAccepted, t)
+	default:
+		response.WriteHeaderAndEntity(http.StatusConflict, t)
+	}
+}
+
+// POST http://localhost:8080/api/v1/tasks/1/cancel
+//
+func (r *Resource) cancel(request *restful.Request, response *restful.Response) {
+	t, err := r.store.Cancel(request.Request.Context(), request.PathParameter("task-id"))
+	if err != nil {
+		writeError(response, err)
+		return
+	}
+	response.WriteEntity(t)
+}
+
+// writeError maps store errors to HTTP responses.
+func writeError(response *restful.Response, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		response.WriteErrorString(http.StatusNotFound, "Task could not be found.")
+	case errors.Is(err, ErrInvalidTransition):
+		response.WriteErrorString(http.StatusConflict, err.Error())
+	default:
+		if status, ok := postgres.HTTPStatus(err); ok {
+			response.WriteErrorString(status, http.StatusText(status))
+			return
+		}
+		response.WriteError(http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,83 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/require"
+)
+
+func call(t *testing.T, method, url, body string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestResource(t *testing.T) {
+	store := NewMemoryStore()
+	c := restful.NewContainer()
+	c.Add(NewResource(store, nil, "report").WebService())
+	ts := httptest.NewServer(c)
+	defer ts.Close()
+
+	resp, _ := call(t, http.MethodPost, ts.URL+ResourceRootPath+"/", `{"type":"unknown"}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body := call(t, http.MethodPost, ts.URL+ResourceRootPath+"/", `{"type":"report","payload":{"db":"orcl"}}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, string(body))
+	var submitted Task
+	require.NoError(t, json.Unmarshal(body, &submitted))
+	location := resp.Header.Get("Location")
+	require.Equal(t, ResourceRootPath+"/"+submitted.ID, location)
+
+	resp, body = call(t, http.MethodGet, ts.URL+location, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Retry-After"))
+	var got Task
+	require.NoError(t, json.Unmarshal(body, &got))
+	require.Equal(t, Queued, got.Status)
+
+	resp, _ = call(t, http.MethodGet, ts.URL+location+"/result", "")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	ctx := context.Background()
+	_, err := store.Start(ctx, submitted.ID)
+	require.NoError(t, err)
+	_, err = store.Succeed(ctx, submitted.ID, json.RawMessage(`{"pages":3}`))
+	require.NoError(t, err)
+
+	resp, body = call(t, http.MethodGet, ts.URL+location+"/result", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"pages":3}`, string(body))
+
+	resp, _ = call(t, http.MethodPost, ts.URL+location+"/cancel", "")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, body = call(t, http.MethodPost, ts.URL+ResourceRootPath+"/", `{"type":"report"}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, json.Unmarshal(body, &submitted))
+
+	resp, body = call(t, http.MethodPost, ts.URL+ResourceRootPath+"/"+submitted.ID+"/cancel", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal(body, &got))
+	require.Equal(t, Cancelled, got.Status)
+
+	resp, _ = call(t, http.MethodGet, ts.URL+ResourceRootPath+"/"+submitted.ID+"/result", "")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp, _ = call(t, http.MethodGet, ts.URL+ResourceRootPath+"/does-not-exist", "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
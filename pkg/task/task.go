@@ -0,0 +1,157 @@
+// Package task runs long-running work asynchronously. Clients submit a task
+// through the REST API, get 202 Accepted with the task location, and poll the
+// task for its status and result. Tasks are persisted in the task table and
+// run by a Pool of workers inside the server process.
+package task
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is the state of a task.
+type Status string
+
+// Task states. A task starts queued; succeeded, failed, cancelled and dead are
+// final. A running task whose attempt failed goes back to queued to be retried,
+// or to dead once it ran out of attempts.
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+	Dead      Status = "dead"
+)
+
+var (
+	// ErrNotFound is returned when a task does not exist.
+	ErrNotFound = errors.New("task not found")
+
+	// ErrInvalidTransition is returned when a task cannot move to the requested state.
+	ErrInvalidTransition = errors.New("invalid task state transition")
+
+	// ErrNoTask is returned by Queue.Claim when no task is ready to run.
+	ErrNoTask = errors.New("no task to run")
+
+	// ErrLeaseLost is returned when a worker no longer owns the task it runs,
+	// because the task was cancelled or re-queued after missing heartbeats.
+	ErrLeaseLost = errors.New("task lease lost")
+)
+
+// transitions lists the states each state can move to.
+var transitions = map[Status][]Status{
+	Queued:  {Running, Cancelled},
+	Running: {Succeeded, Failed, Cancelled, Queued, Dead},
+}
+
+// Final reports whether s is a final state.
+func (s Status) Final() bool {
+	return len(transitions[s]) == 0
+}
+
+// canMove reports whether a task can move from state from to state to.
+func canMove(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTransition(id string, from, to Status) error {
+	if !canMove(from, to) {
+		return fmt.Errorf("%w: task %s is %s, cannot become %s", ErrInvalidTransition, id, from, to)
+	}
+	return nil
+}
+
+// Task is a unit of asynchronous work.
+type Task struct {
+	ID          string          `json:"id" description:"identifier of the task"`
+	Type        string          `json:"type" description:"kind of work, selects the handler"`
+	Status      Status          `json:"status" description:"queued, running, succeeded, failed, cancelled or dead"`
+	Payload     json.RawMessage `json:"payload,omitempty" description:"input of the task"`
+	Result      json.RawMessage `json:"result,omitempty" description:"output of a succeeded task"`
+	Error       string          `json:"error,omitempty" description:"why the task or its last attempt failed"`
+	Attempts    int             `json:"attempts" description:"number of times a worker started the task"`
+	SubmittedAt time.Time       `json:"submitted_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Store persists tasks and their state transitions.
+type Store interface {
+	// Create stores a new queued task of the given type and returns it.
+	Create(ctx context.Context, taskType string, payload json.RawMessage) (*Task, error)
+	Get(ctx context.Context, id string) (*Task, error)
+	// Start moves a queued task to running.
+	Start(ctx context.Context, id string) (*Task, error)
+	// Succeed moves a running task to succeeded with the given result.
+	Succeed(ctx context.Context, id string, result json.RawMessage) (*Task, error)
+	// Fail moves a running task to failed with the given error.
+	Fail(ctx context.Context, id string, cause error) (*Task, error)
+	// Cancel moves a queued or running task to cancelled.
+	Cancel(ctx context.Context, id string) (*Task, error)
+}
+
+// Outcome is how an attempt to run a task ended.
+type Outcome struct {
+	// Status is Succeeded, Failed, Dead, or Queued to run the task again
+	// after RetryAt.
+	Status  Status
+	Result  json.RawMessage
+	Error   string
+	RetryAt time.Time
+}
+
+// Queue is the worker side of a Store. A worker owns the tasks it claimed
+// until it releases them or stops sending heartbeats.
+type Queue interface {
+	Store
+	// Claim moves the oldest queued task of one of types whose retry time
+	// has come to running, owned by worker. It returns ErrNoTask if there is none.
+	Claim(ctx context.Context, worker string, types []string) (*Task, error)
+	// Heartbeat records that worker is still running task id. It returns
+	// ErrLeaseLost if the task is no longer running for worker.
+	Heartbeat(ctx context.Context, id, worker string) error
+	// Release ends the attempt of worker on task id with outcome o. It
+	// returns ErrLeaseLost if the task is no longer running for worker.
+	Release(ctx context.Context, id, worker string, o Outcome) (*Task, error)
+	// Requeue moves running tasks without a heartbeat for longer than timeout
+	// back to queued, or to dead once they were attempted maxAttempts times,
+	// and returns how many tasks it moved.
+	Requeue(ctx context.Context, timeout time.Duration, maxAttempts int) (int, error)
+}
+
+// newID returns a random task ID.
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// apply moves t to state to, stamping the transition time now.
+func apply(t *Task, to Status, now time.Time) {
+	t.Status = to
+	t.UpdatedAt = now
+	if to == Running {
+		t.StartedAt = &now
+		t.Attempts++
+	}
+	if to.Final() {
+		t.FinishedAt = &now
+	}
+}
+
+// lostHeartbeat is the error recorded on tasks re-queued by Requeue.
+const lostHeartbeat = "worker stopped sending heartbeats"
@@ -0,0 +1,161 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreTransitions runs the task life cycle against s.
+func testStoreTransitions(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	created, err := s.Create(ctx, "report", json.RawMessage(`{"db":"orcl"}`))
+	require.NoError(t, err)
+	require.Equal(t, Queued, created.Status)
+	require.JSONEq(t, `{"db":"orcl"}`, string(created.Payload))
+	require.Nil(t, created.StartedAt)
+
+	_, err = s.Succeed(ctx, created.ID, nil)
+	require.True(t, errors.Is(err, ErrInvalidTransition), "got %v", err)
+
+	running, err := s.Start(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, Running, running.Status)
+	require.NotNil(t, running.StartedAt)
+
+	done, err := s.Succeed(ctx, created.ID, json.RawMessage(`{"pages":3}`))
+	require.NoError(t, err)
+	require.Equal(t, Succeeded, done.Status)
+	require.NotNil(t, done.FinishedAt)
+
+	got, err := s.Get(ctx, created.ID)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"pages":3}`, string(got.Result))
+
+	_, err = s.Cancel(ctx, created.ID)
+	require.True(t, errors.Is(err, ErrInvalidTransition), "got %v", err)
+
+	failing, err := s.Create(ctx, "report", nil)
+	require.NoError(t, err)
+	require.Empty(t, failing.Payload)
+	_, err = s.Start(ctx, failing.ID)
+	require.NoError(t, err)
+	failed, err := s.Fail(ctx, failing.ID, errors.New("database unreachable"))
+	require.NoError(t, err)
+	require.Equal(t, Failed, failed.Status)
+	require.Equal(t, "database unreachable", failed.Error)
+
+	queued, err := s.Create(ctx, "report", nil)
+	require.NoError(t, err)
+	cancelled, err := s.Cancel(ctx, queued.ID)
+	require.NoError(t, err)
+	require.Equal(t, Cancelled, cancelled.Status)
+
+	_, err = s.Get(ctx, "does-not-exist")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = s.Start(ctx, "does-not-exist")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStoreTransitions(t, NewMemoryStore())
+}
+
+func TestStatusFinal(t *testing.T) {
+	for s, want := range map[Status]bool{
+		Queued:    false,
+		Running:   false,
+		Succeeded: true,
+		Failed:    true,
+		Cancelled: true,
+		Dead:      true,
+	} {
+		require.Equal(t, want, s.Final(), s)
+	}
+}
+
+// testQueue runs the worker side of the task life cycle against q.
+func testQueue(t *testing.T, q Queue) {
+	ctx := context.Background()
+
+	_, err := q.Claim(ctx, "w1", []string{"report"})
+	require.ErrorIs(t, err, ErrNoTask)
+
+	created, err := q.Create(ctx, "report", nil)
+	require.NoError(t, err)
+	other, err := q.Create(ctx, "other", nil)
+	require.NoError(t, err)
+
+	claimed, err := q.Claim(ctx, "w1", []string{"report"})
+	require.NoError(t, err)
+	require.Equal(t, created.ID, claimed.ID)
+	require.Equal(t, Running, claimed.Status)
+	require.Equal(t, 1, claimed.Attempts)
+
+	_, err = q.Claim(ctx, "w2", []string{"report"})
+	require.ErrorIs(t, err, ErrNoTask, "a running task cannot be claimed twice")
+
+	require.NoError(t, q.Heartbeat(ctx, claimed.ID, "w1"))
+	require.ErrorIs(t, q.Heartbeat(ctx, claimed.ID, "w2"), ErrLeaseLost)
+
+	retried, err := q.Release(ctx, claimed.ID, "w1", Outcome{Status: Queued, Error: "timeout", RetryAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, Queued, retried.Status)
+	require.Equal(t, "timeout", retried.Error)
+	_, err = q.Claim(ctx, "w1", []string{"report"})
+	require.ErrorIs(t, err, ErrNoTask, "a task is not claimed before its retry time")
+
+	claimed, err = q.Claim(ctx, "w1", []string{"other"})
+	require.NoError(t, err)
+	require.Equal(t, other.ID, claimed.ID)
+
+	_, err = q.Release(ctx, claimed.ID, "w2", Outcome{Status: Succeeded})
+	require.ErrorIs(t, err, ErrLeaseLost)
+	done, err := q.Release(ctx, claimed.ID, "w1", Outcome{Status: Succeeded, Result: json.RawMessage(`{"ok":true}`)})
+	require.NoError(t, err)
+	require.Equal(t, Succeeded, done.Status)
+	require.JSONEq(t, `{"ok":true}`, string(done.Result))
+	require.ErrorIs(t, q.Heartbeat(ctx, claimed.ID, "w1"), ErrLeaseLost)
+
+	// A task whose worker stopped sending heartbeats goes back to the queue,
+	// then to dead once it ran out of attempts.
+	abandoned, err := q.Create(ctx, "lost", nil)
+	require.NoError(t, err)
+	_, err = q.Claim(ctx, "w1", []string{"lost"})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	n, err := q.Requeue(ctx, time.Hour, 2)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	n, err = q.Requeue(ctx, 10*time.Millisecond, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	got, err := q.Get(ctx, abandoned.ID)
+	require.NoError(t, err)
+	require.Equal(t, Queued, got.Status)
+	require.Equal(t, lostHeartbeat, got.Error)
+	_, err = q.Release(ctx, abandoned.ID, "w1", Outcome{Status: Succeeded})
+	require.ErrorIs(t, err, ErrLeaseLost)
+
+	claimed, err = q.Claim(ctx, "w2", []string{"lost"})
+	require.NoError(t, err)
+	require.Equal(t, 2, claimed.Attempts)
+	time.Sleep(50 * time.Millisecond)
+	n, err = q.Requeue(ctx, 10*time.Millisecond, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	got, err = q.Get(ctx, abandoned.ID)
+	require.NoError(t, err)
+	require.Equal(t, Dead, got.Status)
+	require.NotNil(t, got.FinishedAt)
+}
+
+func TestMemoryQueue(t *testing.T) {
+	testQueue(t, NewMemoryStore())
+}